@@ -0,0 +1,279 @@
+/*
+ * archive.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package archive reads built pacman package files such as those produced by makepkg.
+*/
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// magic numbers of the compression formats makepkg produces
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+/*
+Decompress returns a reader of the uncompressed contents of r.
+The compression format, zstd, xz, or gzip, is detected from the data; uncompressed data is returned as-is.
+The returned reader must be closed to release the decompressor's resources.
+*/
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	b := bufio.NewReader(r)
+	header, err := b.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, zstdMagic):
+		d, err := zstd.NewReader(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd archive: %w", err)
+		}
+		return d.IOReadCloser(), nil
+	case bytes.HasPrefix(header, xzMagic):
+		d, err := xz.NewReader(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress xz archive: %w", err)
+		}
+		return io.NopCloser(d), nil
+	case bytes.HasPrefix(header, gzipMagic):
+		d, err := gzip.NewReader(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip archive: %w", err)
+		}
+		return d, nil
+	default:
+		return io.NopCloser(b), nil
+	}
+}
+
+/*
+An Info holds the metadata of a package's .PKGINFO file.
+*/
+type Info struct {
+	Name         string
+	Base         string
+	Version      string // full version, including any epoch and the release
+	Description  string
+	URL          string
+	BuildDate    int64 // Unix timestamp
+	Packager     string
+	Size         int64 // installed size in bytes
+	Arch         string
+	License      []string
+	Replaces     []string
+	Groups       []string
+	Conflicts    []string
+	Provides     []string
+	Backup       []string
+	Depends      []string
+	OptDepends   []string
+	MakeDepends  []string
+	CheckDepends []string
+	XData        []string
+}
+
+/*
+ParseInfo reads a .PKGINFO file from r.
+Blank lines and comments starting with '#' are skipped; unknown keys are ignored.
+Any read error or malformed line is returned in err.
+*/
+func ParseInfo(r io.Reader) (info *Info, err error) {
+	info = new(Info)
+	lists := map[string]*[]string{
+		"license":     &info.License,
+		"replaces":    &info.Replaces,
+		"group":       &info.Groups,
+		"conflict":    &info.Conflicts,
+		"provides":    &info.Provides,
+		"backup":      &info.Backup,
+		"depend":      &info.Depends,
+		"optdepend":   &info.OptDepends,
+		"makedepend":  &info.MakeDepends,
+		"checkdepend": &info.CheckDepends,
+		"xdata":       &info.XData,
+	}
+	values := map[string]*string{
+		"pkgname":  &info.Name,
+		"pkgbase":  &info.Base,
+		"pkgver":   &info.Version,
+		"pkgdesc":  &info.Description,
+		"url":      &info.URL,
+		"packager": &info.Packager,
+		"arch":     &info.Arch,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf(".PKGINFO line %d: expected 'key = value'", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "builddate", "size":
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf(".PKGINFO line %d: invalid %s '%s'", n, key, value)
+			}
+			if key == "size" {
+				info.Size = i
+			} else {
+				info.BuildDate = i
+			}
+		default:
+			if list, ok := lists[key]; ok {
+				*list = append(*list, value)
+			} else if v, ok := values[key]; ok {
+				*v = value
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read .PKGINFO: %w", err)
+	}
+	if info.Name == "" || info.Version == "" {
+		return nil, fmt.Errorf(".PKGINFO is missing pkgname or pkgver")
+	}
+	if info.Base == "" {
+		info.Base = info.Name
+	}
+
+	return
+}
+
+/*
+An Entry is a file, directory, or link installed by a package.
+*/
+type Entry struct {
+	Path string // path relative to the installation root; directories end with '/'
+	Mode fs.FileMode
+	Size int64
+	Link string // target of a symbolic or hard link
+}
+
+/*
+A Package is the contents of a package file.
+*/
+type Package struct {
+	Info      *Info
+	BuildInfo *BuildInfo   // nil if the package has no .BUILDINFO
+	MTree     []MTreeEntry // empty if the package has no .MTREE
+	Install   string       // contents of the .INSTALL scriptlet, if any
+	Entries   []Entry      // installed files in archive order, excluding the package's metadata files
+}
+
+/*
+isMetadata reports whether the archive path p is one of the metadata files makepkg adds to the package root,
+such as .PKGINFO, .BUILDINFO, .MTREE, or .INSTALL.
+*/
+func isMetadata(p string) bool {
+	return strings.HasPrefix(p, ".") && !strings.Contains(p, "/")
+}
+
+/*
+Read reads the package file at path.
+Any error opening or decompressing the file, or a missing or malformed .PKGINFO, is returned in err.
+*/
+func Read(path string) (pkg *Package, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package file: %w", err)
+	}
+	defer f.Close()
+	r, err := Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	pkg = new(Package)
+	tarReader := tar.NewReader(r)
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read package file %s: %w", path, err)
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+
+		switch {
+		case name == ".PKGINFO":
+			if pkg.Info, err = ParseInfo(tarReader); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		case name == ".BUILDINFO":
+			if pkg.BuildInfo, err = ParseBuildInfo(tarReader); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		case name == ".MTREE":
+			// the mtree specification is itself gzip-compressed
+			d, err := Decompress(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("%s: .MTREE: %w", path, err)
+			}
+			pkg.MTree, err = ParseMTree(d)
+			d.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		case name == ".INSTALL":
+			contents, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read package file %s: %w", path, err)
+			}
+			pkg.Install = string(contents)
+		case isMetadata(name):
+		default:
+			if h.Typeflag == tar.TypeDir && !strings.HasSuffix(name, "/") {
+				name += "/"
+			}
+			pkg.Entries = append(pkg.Entries, Entry{name, h.FileInfo().Mode(), h.Size, h.Linkname})
+		}
+	}
+	if pkg.Info == nil {
+		return nil, fmt.Errorf("%s: not a package file: .PKGINFO not found", path)
+	}
+
+	return
+}
@@ -0,0 +1,229 @@
+/*
+ * archive_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressors produce in-memory fixtures in each format Decompress detects
+var compressors = map[string]func(t *testing.T, data []byte) []byte{
+	"zstd": func(t *testing.T, data []byte) []byte {
+		var b bytes.Buffer
+		w, err := zstd.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return closeWriter(t, &b, w, data)
+	},
+	"xz": func(t *testing.T, data []byte) []byte {
+		var b bytes.Buffer
+		w, err := xz.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return closeWriter(t, &b, w, data)
+	},
+	"gzip": func(t *testing.T, data []byte) []byte {
+		var b bytes.Buffer
+		return closeWriter(t, &b, gzip.NewWriter(&b), data)
+	},
+	"none": func(t *testing.T, data []byte) []byte { return data },
+}
+
+// closeWriter writes data through w and returns what it wrote to b.
+func closeWriter(t *testing.T, b *bytes.Buffer, w io.WriteCloser, data []byte) []byte {
+	t.Helper()
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	data := []byte(strings.Repeat("pkgname = example\n", 100))
+	for format, compress := range compressors {
+		r, err := Decompress(bytes.NewReader(compress(t, data)))
+		if err != nil {
+			t.Errorf("Decompress(%s) error: %v", format, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress(%s) read %d bytes (%v), want the original %d", format, len(got), err, len(data))
+		}
+	}
+
+	// data shorter than the longest magic number is returned as-is
+	r, err := Decompress(strings.NewReader("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "ab" {
+		t.Errorf("Decompress(short) = %q, want %q", got, "ab")
+	}
+	// a corrupt header of a recognized format is an error
+	if _, err := Decompress(bytes.NewReader([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0xff, 0xff})); err == nil {
+		t.Error("Decompress(corrupt xz) succeeded")
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	pkginfo := `# Generated by makepkg 6.1.0
+pkgname = example-git
+pkgbase = example
+xdata = pkgtype=split
+pkgver = 1:2.0.r3.gabcdef-1
+pkgdesc = An example = with equals
+url = https://example.org
+builddate = 1700000000
+packager = Someone <someone@example.org>
+size = 123456
+arch = x86_64
+license = MIT
+license = Apache-2.0
+replaces = example-old
+group = examples
+conflict = example
+provides = example=2.0
+backup = etc/example.conf
+depend = glibc
+depend = zlib>=1.3
+optdepend = python: for scripts
+makedepend = git
+checkdepend = check
+unknown = ignored
+`
+	info, err := ParseInfo(strings.NewReader(pkginfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{
+		Name: "example-git", Base: "example", Version: "1:2.0.r3.gabcdef-1", Description: "An example = with equals",
+		URL: "https://example.org", BuildDate: 1700000000, Packager: "Someone <someone@example.org>", Size: 123456, Arch: "x86_64",
+		License: []string{"MIT", "Apache-2.0"}, Replaces: []string{"example-old"}, Groups: []string{"examples"},
+		Conflicts: []string{"example"}, Provides: []string{"example=2.0"}, Backup: []string{"etc/example.conf"},
+		Depends: []string{"glibc", "zlib>=1.3"}, OptDepends: []string{"python: for scripts"}, MakeDepends: []string{"git"},
+		CheckDepends: []string{"check"}, XData: []string{"pkgtype=split"},
+	}
+	if !reflect.DeepEqual(*info, want) {
+		t.Errorf("ParseInfo = %+v, want %+v", *info, want)
+	}
+
+	// pkgbase defaults to pkgname
+	if info, err := ParseInfo(strings.NewReader("pkgname = solo\npkgver = 1-1\n")); err != nil || info.Base != "solo" {
+		t.Errorf("ParseInfo without pkgbase = %+v, %v; want base solo", info, err)
+	}
+
+	for _, bad := range []string{
+		"pkgname = x\npkgver = 1-1\nnot a key value line\n",
+		"pkgname = x\npkgver = 1-1\nsize = big\n",
+		"pkgname = x\npkgver = 1-1\nbuilddate = yesterday\n",
+		"pkgver = 1-1\n",
+		"pkgname = x\n",
+	} {
+		if _, err := ParseInfo(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseInfo(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	var mtree bytes.Buffer
+	gz := gzip.NewWriter(&mtree)
+	gz.Write([]byte("#mtree\n./usr/bin/example time=1700000000.0 mode=755 size=4 type=file\n"))
+	gz.Close()
+
+	files := []struct {
+		header   tar.Header
+		contents string
+	}{
+		{tar.Header{Name: ".PKGINFO", Mode: 0644}, "pkgname = example\npkgver = 1.0-1\n"},
+		{tar.Header{Name: ".BUILDINFO", Mode: 0644}, "format = 2\npkgname = example\n"},
+		{tar.Header{Name: ".MTREE", Mode: 0644}, mtree.String()},
+		{tar.Header{Name: ".INSTALL", Mode: 0644}, "post_install() { :; }\n"},
+		{tar.Header{Name: "usr", Mode: 0755, Typeflag: tar.TypeDir}, ""},
+		{tar.Header{Name: "usr/bin/example", Mode: 0755}, "#!/bin/sh\n"},
+		{tar.Header{Name: "usr/bin/ex", Typeflag: tar.TypeSymlink, Linkname: "example"}, ""},
+	}
+	var b bytes.Buffer
+	tarWriter := tar.NewWriter(&b)
+	for _, f := range files {
+		h := f.header
+		h.Size = int64(len(f.contents))
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		if err := tarWriter.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		tarWriter.Write([]byte(f.contents))
+	}
+	tarWriter.Close()
+
+	for format, compress := range compressors {
+		path := filepath.Join(t.TempDir(), "example-1.0-1-x86_64.pkg.tar")
+		if err := os.WriteFile(path, compress(t, b.Bytes()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := Read(path)
+		if err != nil {
+			t.Errorf("Read(%s) error: %v", format, err)
+			continue
+		}
+		if pkg.Info.Name != "example" || pkg.BuildInfo == nil || pkg.BuildInfo.Format != "2" ||
+			len(pkg.MTree) != 1 || pkg.MTree[0].Path != "usr/bin/example" || !strings.HasPrefix(pkg.Install, "post_install") {
+			t.Errorf("Read(%s) metadata = %+v", format, pkg)
+		}
+		want := []Entry{
+			{"usr/", fs.ModeDir | 0755, 0, ""},
+			{"usr/bin/example", 0755, 10, ""},
+			{"usr/bin/ex", fs.ModeSymlink, 0, "example"},
+		}
+		if !slices.Equal(pkg.Entries, want) {
+			t.Errorf("Read(%s) entries = %v, want %v", format, pkg.Entries, want)
+		}
+	}
+
+	// an archive without .PKGINFO is not a package
+	path := filepath.Join(t.TempDir(), "empty.tar")
+	var empty bytes.Buffer
+	tar.NewWriter(&empty).Close()
+	os.WriteFile(path, empty.Bytes(), 0644)
+	if _, err := Read(path); err == nil {
+		t.Error("Read of an archive without .PKGINFO succeeded")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * buildinfo.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+A BuildInfo holds the description of a package's build environment from its .BUILDINFO file.
+*/
+type BuildInfo struct {
+	Format            string
+	Name              string
+	Base              string
+	Version           string
+	Arch              string
+	PKGBUILDSHA256Sum string
+	Packager          string
+	BuildDate         int64 // Unix timestamp
+	BuildDir          string
+	StartDir          string
+	BuildTool         string
+	BuildToolVersion  string
+	BuildEnv          []string // makepkg.conf BUILDENV settings
+	Options           []string // makepkg.conf OPTIONS settings
+	Installed         []string // name-version-release-arch of each package installed during the build
+}
+
+/*
+ParseBuildInfo reads a .BUILDINFO file from r.
+Blank lines and comments starting with '#' are skipped; unknown keys are ignored.
+Any read error or malformed line is returned in err.
+*/
+func ParseBuildInfo(r io.Reader) (info *BuildInfo, err error) {
+	info = new(BuildInfo)
+	lists := map[string]*[]string{
+		"buildenv":  &info.BuildEnv,
+		"options":   &info.Options,
+		"installed": &info.Installed,
+	}
+	values := map[string]*string{
+		"format":             &info.Format,
+		"pkgname":            &info.Name,
+		"pkgbase":            &info.Base,
+		"pkgver":             &info.Version,
+		"pkgarch":            &info.Arch,
+		"pkgbuild_sha256sum": &info.PKGBUILDSHA256Sum,
+		"packager":           &info.Packager,
+		"builddir":           &info.BuildDir,
+		"startdir":           &info.StartDir,
+		"buildtool":          &info.BuildTool,
+		"buildtoolver":       &info.BuildToolVersion,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf(".BUILDINFO line %d: expected 'key = value'", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if key == "builddate" {
+			if info.BuildDate, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf(".BUILDINFO line %d: invalid builddate '%s'", n, value)
+			}
+		} else if list, ok := lists[key]; ok {
+			*list = append(*list, value)
+		} else if v, ok := values[key]; ok {
+			*v = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read .BUILDINFO: %w", err)
+	}
+
+	return
+}
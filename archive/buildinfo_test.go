@@ -0,0 +1,74 @@
+/*
+ * buildinfo_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package archive
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseBuildInfo(t *testing.T) {
+	buildinfo := `format = 2
+pkgname = example
+pkgbase = example
+pkgver = 1.0-1
+pkgarch = x86_64
+pkgbuild_sha256sum = 0123456789abcdef
+packager = Someone <someone@example.org>
+builddate = 1700000000
+builddir = /build
+startdir = /startdir
+buildtool = makepkg
+buildtoolver = 6.1.0
+buildenv = !distcc
+buildenv = color
+options = strip
+options = !debug
+installed = glibc-2.40-1-x86_64
+installed = zlib-1:1.3.1-2-x86_64
+`
+	info, err := ParseBuildInfo(strings.NewReader(buildinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "2" || info.Name != "example" || info.Base != "example" || info.Version != "1.0-1" || info.Arch != "x86_64" ||
+		info.PKGBUILDSHA256Sum != "0123456789abcdef" || info.Packager != "Someone <someone@example.org>" || info.BuildDate != 1700000000 ||
+		info.BuildDir != "/build" || info.StartDir != "/startdir" || info.BuildTool != "makepkg" || info.BuildToolVersion != "6.1.0" {
+		t.Errorf("ParseBuildInfo = %+v", *info)
+	}
+	for _, list := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"buildenv", info.BuildEnv, []string{"!distcc", "color"}},
+		{"options", info.Options, []string{"strip", "!debug"}},
+		{"installed", info.Installed, []string{"glibc-2.40-1-x86_64", "zlib-1:1.3.1-2-x86_64"}},
+	} {
+		if !slices.Equal(list.got, list.want) {
+			t.Errorf("ParseBuildInfo %s = %q, want %q", list.name, list.got, list.want)
+		}
+	}
+
+	for _, bad := range []string{"format = 2\nno separator\n", "builddate = soon\n"} {
+		if _, err := ParseBuildInfo(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseBuildInfo(%q) succeeded", bad)
+		}
+	}
+}
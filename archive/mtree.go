@@ -0,0 +1,166 @@
+/*
+ * mtree.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+/*
+An MTreeEntry is one file described by a package's .MTREE file,
+which records the attributes and digests of every file the package installs.
+*/
+type MTreeEntry struct {
+	Path         string // path relative to the installation root
+	Type         string // file, dir, link, etc.
+	Mode         fs.FileMode
+	UID          int
+	GID          int
+	Size         int64
+	Time         int64 // modification time as a Unix timestamp
+	Link         string
+	MD5Digest    string
+	SHA256Digest string
+}
+
+/*
+ParseMTree reads an uncompressed mtree specification from r.
+/set and /unset lines change the defaults applied to the entries following them.
+Any read error or malformed value is returned in err.
+*/
+func ParseMTree(r io.Reader) (entries []MTreeEntry, err error) {
+	defaults := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "/set":
+			for _, f := range fields[1:] {
+				key, value, _ := strings.Cut(f, "=")
+				defaults[key] = value
+			}
+		case "/unset":
+			for _, key := range fields[1:] {
+				delete(defaults, key)
+			}
+		default:
+			keywords := maps.Clone(defaults)
+			for _, f := range fields[1:] {
+				key, value, _ := strings.Cut(f, "=")
+				keywords[key] = value
+			}
+			e, err := newMTreeEntry(unescapeMTree(fields[0]), keywords)
+			if err != nil {
+				return nil, fmt.Errorf(".MTREE line %d: %w", n, err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read .MTREE: %w", err)
+	}
+
+	return
+}
+
+// newMTreeEntry builds the entry for path from its mtree keywords.
+func newMTreeEntry(path string, keywords map[string]string) (e MTreeEntry, err error) {
+	e = MTreeEntry{
+		Path:         strings.TrimPrefix(path, "./"),
+		Type:         keywords["type"],
+		Link:         unescapeMTree(keywords["link"]),
+		MD5Digest:    keywords["md5digest"],
+		SHA256Digest: keywords["sha256digest"],
+	}
+	integer := func(key string, bits int) (i int64) {
+		if v, ok := keywords[key]; ok && err == nil {
+			if i, err = strconv.ParseInt(v, 10, bits); err != nil {
+				err = fmt.Errorf("invalid %s '%s'", key, v)
+			}
+		}
+		return
+	}
+	e.UID = int(integer("uid", 32))
+	e.GID = int(integer("gid", 32))
+	e.Size = integer("size", 64)
+	if v, ok := keywords["mode"]; ok && err == nil {
+		mode, parseErr := strconv.ParseUint(v, 8, 32)
+		if parseErr != nil {
+			return e, fmt.Errorf("invalid mode '%s'", v)
+		}
+		e.Mode = fileMode(mode)
+	}
+	if v, ok := keywords["time"]; ok && err == nil {
+		// times are seconds with an optional fraction
+		seconds, _, _ := strings.Cut(v, ".")
+		if e.Time, err = strconv.ParseInt(seconds, 10, 64); err != nil {
+			err = fmt.Errorf("invalid time '%s'", v)
+		}
+	}
+
+	return
+}
+
+// fileMode converts Unix permission bits, including the setuid, setgid and sticky bits, to an fs.FileMode.
+func fileMode(mode uint64) fs.FileMode {
+	m := fs.FileMode(mode).Perm()
+	for bit, special := range map[uint64]fs.FileMode{04000: fs.ModeSetuid, 02000: fs.ModeSetgid, 01000: fs.ModeSticky} {
+		if mode&bit != 0 {
+			m |= special
+		}
+	}
+
+	return m
+}
+
+/*
+unescapeMTree decodes the backslash escapes of an mtree path, which encode
+characters such as spaces as a backslash followed by three octal digits.
+*/
+func unescapeMTree(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
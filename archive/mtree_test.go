@@ -0,0 +1,102 @@
+/*
+ * mtree_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package archive
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMTree(t *testing.T) {
+	mtree := `#mtree
+/set type=file uid=0 gid=0 mode=644
+./.PKGINFO time=1700000000.0 size=500 md5digest=d41d8cd98f00b204e9800998ecf8427e sha256digest=e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+./usr time=1700000000.0 mode=755 type=dir
+./usr/bin/sudo time=1700000000.5 mode=4755 size=1000
+./usr/bin/locate time=1700000000.0 mode=2755 gid=21 size=2000
+./tmp time=1700000000.0 mode=1777 type=dir
+./usr/share/doc/my\040file time=1700000000.0 size=3
+/unset uid gid
+./usr/bin/link time=1700000000.0 mode=777 type=link link=target\040name
+`
+	entries, err := ParseMTree(strings.NewReader(mtree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MTreeEntry{
+		{Path: ".PKGINFO", Type: "file", Mode: 0644, Size: 500, Time: 1700000000,
+			MD5Digest: "d41d8cd98f00b204e9800998ecf8427e", SHA256Digest: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{Path: "usr", Type: "dir", Mode: 0755, Time: 1700000000},
+		{Path: "usr/bin/sudo", Type: "file", Mode: fs.ModeSetuid | 0755, Size: 1000, Time: 1700000000},
+		{Path: "usr/bin/locate", Type: "file", Mode: fs.ModeSetgid | 0755, GID: 21, Size: 2000, Time: 1700000000},
+		{Path: "tmp", Type: "dir", Mode: fs.ModeSticky | 0777, Time: 1700000000},
+		{Path: "usr/share/doc/my file", Type: "file", Mode: 0644, Size: 3, Time: 1700000000},
+		{Path: "usr/bin/link", Type: "link", Mode: 0777, Time: 1700000000, Link: "target name"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("ParseMTree =\n%+v\nwant\n%+v", entries, want)
+	}
+
+	for _, bad := range []string{
+		"./file mode=999\n",
+		"./file uid=root\n",
+		"./file size=-x\n",
+		"./file time=now\n",
+	} {
+		if _, err := ParseMTree(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseMTree(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	tests := []struct {
+		mode uint64
+		want fs.FileMode
+	}{
+		{0644, 0644},
+		{04755, fs.ModeSetuid | 0755},
+		{02755, fs.ModeSetgid | 0755},
+		{01777, fs.ModeSticky | 0777},
+		{07777, fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky | 0777},
+	}
+	for _, tt := range tests {
+		if got := fileMode(tt.mode); got != tt.want {
+			t.Errorf("fileMode(%o) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeMTree(t *testing.T) {
+	tests := map[string]string{
+		`plain`:              "plain",
+		`with\040space`:      "with space",
+		`tab\011and\134`:     "tab\tand\\",
+		`trailing\04`:        `trailing\04`,
+		`not\999octal`:       `not\999octal`,
+		`./usr/share/a\040b`: "./usr/share/a b",
+	}
+	for in, want := range tests {
+		if got := unescapeMTree(in); got != want {
+			t.Errorf("unescapeMTree(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
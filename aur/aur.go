@@ -24,11 +24,13 @@ package aur
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 )
 
 // AURHost is the HTTP scheme and domain of the AUR.
@@ -40,28 +42,41 @@ const aurInfoPath = "/rpc/v5/info"
 // AURSearchPath is the URL path of the AUR search endpoint.
 const aurSearchPath = "/rpc/v5/search"
 
+// aurPackagesPath is the URL path of the AUR's web pages for packages.
+const aurPackagesPath = "/packages"
+
+// aurPlainPath is the URL path for retrieving raw files from package git repositories.
+const aurPlainPath = "/cgit/aur.git/plain"
+
+// aurAtomPath is the URL path of the Atom feed of commits to package git repositories.
+const aurAtomPath = "/cgit/aur.git/atom"
+
 // A SearchType is the kind of AUR search to perform.
 // It determines which fields of packages a search term will match against.
 type SearchType int
 
 const (
-	NameDesc     SearchType = iota // match name or description
-	Name                           // match package names only
-	Maintainer                     // match package maintainers
-	Depends                        // match package dependencies
-	MakeDepends                    // match dependencies required to build a package
-	OptDepends                     // match optional dependencies of a package
-	CheckDepends                   // match dependencies required to check a package
+	NameDesc      SearchType = iota // match name or description
+	Name                            // match package names only
+	Maintainer                      // match package maintainers
+	Depends                         // match package dependencies
+	MakeDepends                     // match dependencies required to build a package
+	OptDepends                      // match optional dependencies of a package
+	CheckDepends                    // match dependencies required to check a package
+	CoMaintainers                   // match package co-maintainers
+	Provides                        // match the names of packages and what they provide
 )
 
 var queryKeys = map[SearchType]string{
-	NameDesc:     "name-desc",
-	Name:         "name",
-	Maintainer:   "maintainer",
-	Depends:      "depends",
-	MakeDepends:  "makedepends",
-	OptDepends:   "optdepends",
-	CheckDepends: "checkdepends",
+	NameDesc:      "name-desc",
+	Name:          "name",
+	Maintainer:    "maintainer",
+	Depends:       "depends",
+	MakeDepends:   "makedepends",
+	OptDepends:    "optdepends",
+	CheckDepends:  "checkdepends",
+	CoMaintainers: "comaintainers",
+	Provides:      "provides",
 }
 
 /*
@@ -70,7 +85,7 @@ Searches can be performed against any package detail described as a SearchType i
 The results, if any, do not include details about dependencies, licensing, etc.
 Any Go-generated or AUR error is returned in err.
 */
-func Search(keyword string, by SearchType) (results []aurPackage, err error) {
+func Search(keyword string, by SearchType) (results []Package, err error) {
 	query := make(url.Values)
 	query.Set("by", queryKeys[by])
 
@@ -91,15 +106,15 @@ Info queries the AUR for detailed information about the requested packages.
 The results will include details about licenses, package relationships, etc.
 If the request generates a Go error, or the API returns an error, it is available in err.
 */
-func Info(packages []string) (results []aurPackage, err error) {
+func Info(packages []string) (results []Package, err error) {
 	if len(packages) < 1 {
 		return nil, fmt.Errorf("no packages specified; nothing to do")
 	}
 	// the query string needs escaped brackets, but not the equal sign
-	queryString := fmt.Sprintf("arg%%5B%%5D=%s", packages[0])
+	queryString := fmt.Sprintf("arg%%5B%%5D=%s", url.QueryEscape(packages[0]))
 	if len(packages) > 1 {
 		for _, pkg := range packages[1:] {
-			queryString = fmt.Sprintf("%s&arg%%5B%%5D=%s", queryString, pkg)
+			queryString = fmt.Sprintf("%s&arg%%5B%%5D=%s", queryString, url.QueryEscape(pkg))
 		}
 	}
 
@@ -183,3 +198,85 @@ func DownloadSnapshot(name string) (filepath string, err error) {
 
 	return f.Name(), nil
 }
+
+/*
+GetFile retrieves the current contents of the file with name from the git repository of the package base pkgbase.
+This is useful for reading a package's .SRCINFO or PKGBUILD without downloading a snapshot.
+Any error encountered, including a missing file, is returned in err.
+*/
+func GetFile(pkgbase, name string) (contents []byte, err error) {
+	target, err := url.Parse(AURHost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AUR base URL: %w", err)
+	}
+	target = target.JoinPath(aurPlainPath, name)
+	target.RawQuery = url.Values{"h": []string{pkgbase}}.Encode()
+
+	r, err := http.Get(target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve %s for '%s': %s", name, pkgbase, r.Status)
+	}
+	if contents, err = io.ReadAll(r.Body); err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return
+}
+
+/*
+A Commit is a change to the git repository of a package base.
+*/
+type Commit struct {
+	ID     string // commit hash
+	Title  string // first line of the commit message
+	Author string
+	Time   time.Time
+}
+
+// atomFeed is the subset of the Atom feed of a package's commits that is read.
+type atomFeed struct {
+	Entries []struct {
+		ID      string    `xml:"id"`
+		Title   string    `xml:"title"`
+		Updated time.Time `xml:"updated"`
+		Author  struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+	} `xml:"entry"`
+}
+
+/*
+Log retrieves the most recent commits to the git repository of the package base pkgbase, newest first.
+The AUR's feed holds only a limited number of the latest commits, not the full history.
+*/
+func Log(pkgbase string) (commits []Commit, err error) {
+	target, err := url.Parse(AURHost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AUR base URL: %w", err)
+	}
+	target = target.JoinPath(aurAtomPath)
+	target.RawQuery = url.Values{"h": []string{pkgbase}}.Encode()
+
+	r, err := http.Get(target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve commits of '%s': %s", pkgbase, r.Status)
+	}
+	var feed atomFeed
+	if err = xml.NewDecoder(r.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to parse commits of '%s': %w", pkgbase, err)
+	}
+
+	for _, e := range feed.Entries {
+		commits = append(commits, Commit{e.ID, e.Title, e.Author.Name, e.Updated})
+	}
+
+	return
+}
@@ -21,32 +21,24 @@ package aur
 
 import (
 	"encoding/json"
-	"os"
-	"strings"
+	"fmt"
 	"time"
 
-	"golang.org/x/term"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/format"
+	"github.com/bmoller/pkg/locale"
 )
 
-// fallback value used if terminal width lookup fails
-const defaultWidth = 80
-
-// number of spaces to indent for line continuations
-const leftPadding = 18
-
-// time layout used by pacman
-const timeLayout = "Mon 02 Jan 2006 03:04:05 PM MST"
-
 /*
 A result represents a response from the AUR API.
 The fields are tagged for support of marshalling using Go's json package.
 */
 type result struct {
-	ResultCount int          `json:"resultcount"` // number of results in Results
-	Type        string       `json:"type"`        // AUR response type: error, info, or search
-	Version     int          `json:"version"`     // server-side version of the API
-	Error       string       `json:"error"`       // error message returned by the API, if any
-	Results     []aurPackage `json:"results"`     // slice of packages returned for a search or info request
+	ResultCount int       `json:"resultcount"` // number of results in Results
+	Type        string    `json:"type"`        // AUR response type: error, info, or search
+	Version     int       `json:"version"`     // server-side version of the API
+	Error       string    `json:"error"`       // error message returned by the API, if any
+	Results     []Package `json:"results"`     // slice of packages returned for a search or info request
 }
 
 /*
@@ -61,7 +53,11 @@ func (r *result) String() string {
 	}
 }
 
-type aurPackage struct {
+/*
+A Package holds the details the AUR provides about a single package.
+Search results leave the dependency, licensing, and other relationship fields empty.
+*/
+type Package struct {
 	ID             int
 	Name           string
 	Description    string
@@ -91,10 +87,10 @@ type aurPackage struct {
 }
 
 /*
-String provides the JSON string representation of an AUR result by marshalling the object using Go's json package.
+String provides the JSON string representation of an AUR package by marshalling the object using Go's json package.
 If the function returns an error the returned string is empty.
 */
-func (p aurPackage) String() string {
+func (p Package) String() string {
 	if j, err := json.Marshal(p); err != nil {
 		return ""
 	} else {
@@ -108,70 +104,78 @@ It handles terminals of varying width and should provide output regardless of th
 The overall formatting is very similar to, but not an exact match for,
 the format used by pacman to display information about a package.
 */
-func (p aurPackage) Formatted() string {
-	s := "Name            : " + p.Name + "\n"
-	s += "Version         : " + p.Version + "\n"
-	s += "Description     : " + p.Description + "\n"
-	s += "URL             : " + p.URL + "\n"
-	s += "Licenses        : "
-	s += printArray(p.License)
-	s += "Groups          : "
-	s += printArray(p.Groups)
-	s += "Provides        : "
-	s += printArray(p.Provides)
-	s += "Depends On      : "
-	s += printArray(p.Depends)
-	s += "Optional Deps   : "
-	if len(p.OptDepends) == 0 {
-		s += "None\n"
-	} else {
-		s += strings.Join(p.OptDepends, "\n                  ") + "\n"
-	}
-	s += "Conflicts With  : "
-	s += printArray(p.Conflicts)
-	s += "Replaces        : "
-	s += printArray(p.Replaces)
-	s += "Maintainer      : " + p.Maintainer + "\n"
-	s += "Last Modified   : "
-	s += time.Unix(int64(p.LastModified), 0).Format(timeLayout) + "\n"
-
-	return s
+func (p Package) Formatted() string {
+	return p.Format(format.Terminal(), false)
 }
 
 /*
-printArray builds a string that will display well-formatted in the current terminal.
-It attempts to look up the current terminal's width, but if this fails a default fallback value is used.
+FormattedExtended builds the same representation as Formatted, followed by
+AUR-specific details such as the package base, submitter and co-maintainers.
+It is the equivalent of pacman's doubled --info option.
 */
-func printArray(a []string) string {
-	if len(a) == 0 {
-		return "None\n"
-	}
+func (p Package) FormattedExtended() string {
+	return p.Format(format.Terminal(), true)
+}
 
-	// build a prefix of the appropriate number of spaces
-	padding := ""
-	for range leftPadding {
-		padding += " "
+/*
+Format builds the representation used by Formatted, or by FormattedExtended if extended is true,
+laid out by f rather than for the current terminal.
+The labels of f's layout are padded to end at f.Indent columns.
+*/
+func (p Package) Format(f format.Formatter, extended bool) string {
+	label := f.Label
+
+	s := label("Repository") + color.Repo("aur") + "\n"
+	s += label("Name") + color.Title(p.Name) + "\n"
+	s += label("Version") + color.Version(p.Version) + "\n"
+	s += label("Description") + f.Text(p.Description)
+	s += label("URL") + p.URL + "\n"
+	s += label("AUR URL") + AURHost + aurPackagesPath + "/" + p.Name + "\n"
+	s += label("Licenses")
+	s += f.List(p.License)
+	s += label("Groups")
+	s += f.List(p.Groups)
+	s += label("Provides")
+	s += f.List(p.Provides)
+	s += label("Depends On")
+	s += f.List(p.Depends)
+	s += label("Make Deps")
+	s += f.List(p.MakeDepends)
+	s += label("Check Deps")
+	s += f.List(p.CheckDepends)
+	s += label("Optional Deps")
+	s += f.Lines(p.OptDepends)
+	s += label("Conflicts With")
+	s += f.List(p.Conflicts)
+	s += label("Replaces")
+	s += f.List(p.Replaces)
+	s += label("Keywords")
+	s += f.List(p.Keywords)
+	s += label("Maintainer") + format.OrNone(p.Maintainer) + "\n"
+	s += label("Votes") + fmt.Sprint(p.NumVotes) + "\n"
+	s += label("Popularity") + p.Popularity.String() + "\n"
+	s += label("First Submitted") + formatTime(p.FirstSubmitted) + "\n"
+	s += label("Last Modified") + formatTime(p.LastModified) + "\n"
+	s += label("Out-of-date")
+	if p.OutOfDate == 0 {
+		s += "No\n"
+	} else {
+		s += color.Error("Yes ["+formatTime(p.OutOfDate)+"]") + "\n"
 	}
-
-	// get the width of the terminal
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
-	if err != nil {
-		// set a safe fallback value if the lookup fails
-		width = defaultWidth
+	if extended {
+		s += label("Package Base") + p.PackageBase + "\n"
+		s += label("ID") + fmt.Sprint(p.ID) + "\n"
+		s += label("Package Base ID") + fmt.Sprint(p.PackageBaseID) + "\n"
+		s += label("Submitter") + format.OrNone(p.Submitter) + "\n"
+		s += label("Co-Maintainers")
+		s += f.List(p.CoMaintainers)
+		s += label("Snapshot URL") + AURHost + p.URLPath + "\n"
 	}
 
-	// build a string with line breaks where needed
-	output := ""
-	length := leftPadding
-	for _, s := range a {
-		if length+len(s)+2 > width {
-			output += "\n" + padding
-			length = leftPadding
-		}
-		output += s + "  "
-		length += len(s) + 2
-	}
-	output += "\n"
+	return s
+}
 
-	return output
+// formatTime displays a Unix timestamp in the user's locale.
+func formatTime(t int) string {
+	return locale.Time(time.Unix(int64(t), 0))
 }
@@ -0,0 +1,167 @@
+/*
+ * audit.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/audit"
+	"github.com/bmoller/pkg/color"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit package...",
+	Short: "Scan AUR packages for risky PKGBUILD and script code",
+	Long: `The audit command fetches the snapshot of each package and scans its PKGBUILD,
+install scripts and bundled scripts for risky patterns, such as piping a download
+to a shell, use of sudo, decoding base64 payloads, obfuscated code, and writes
+outside $pkgdir. The sources in its .SRCINFO are checked for downloads over
+plain HTTP without a checksum and for SKIP checksums on sources that are not
+from version control. An argument naming a directory containing a PKGBUILD is
+scanned in place instead of being fetched.
+
+Each finding is listed with its severity, file and line number. The checks are
+heuristics: findings point to code a reviewer should read, and legitimate
+packages can match them.
+
+The exit status is 4 if any finding is at or above the --threshold severity:
+low, medium, high, or critical.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  auditPackages,
+}
+
+var auditThresholdFlag = "high"
+
+func init() {
+	auditCmd.PersistentFlags().StringVarP(&auditThresholdFlag, "threshold", "t", "high", "Lowest severity that makes the exit status non-zero")
+}
+
+/*
+An auditFinding is a finding in the named package.
+*/
+type auditFinding struct {
+	Package  string
+	File     string
+	Line     int
+	Severity audit.Severity
+	Rule     string
+	Message  string
+	Text     string
+}
+
+/*
+auditSources returns the directory holding the sources of the package name,
+fetching its snapshot into a temporary directory unless name is a directory containing a PKGBUILD.
+The returned cleanup function removes any temporary directory.
+*/
+func auditSources(name string) (dir string, cleanup func(), err error) {
+	if _, err := os.Stat(filepath.Join(name, "PKGBUILD")); err == nil {
+		return name, func() {}, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "pkg-audit-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+	if err = fetchPackage(name, tmp); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	// the snapshot holds a single directory named for the package base
+	entries, err := os.ReadDir(tmp)
+	if err != nil || len(entries) != 1 {
+		cleanup()
+		return "", nil, fmt.Errorf("unexpected contents in the snapshot of '%s'", name)
+	}
+
+	return filepath.Join(tmp, entries[0].Name()), cleanup, nil
+}
+
+func auditPackages(cmd *cobra.Command, args []string) {
+	threshold, err := audit.ParseSeverity(auditThresholdFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	var results []auditFinding
+	failed := 0
+	for _, name := range args {
+		dir, cleanup, err := auditSources(name)
+		if err != nil {
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		findings, err := audit.Scan(dir)
+		cleanup()
+		if err != nil {
+			fmt.Printf("%s: %s\n", name, err)
+			failed++
+			continue
+		}
+		for _, f := range findings {
+			results = append(results, auditFinding{name, f.File, f.Line, f.Severity, f.Rule, f.Message, f.Text})
+		}
+		if !machineOutput() {
+			printFindings(name, findings)
+		}
+	}
+	if machineOutput() {
+		printResults(results)
+	}
+
+	exceeded := false
+	for _, r := range results {
+		exceeded = exceeded || r.Severity >= threshold
+	}
+	switch {
+	case failed == len(args):
+		os.Exit(exitError)
+	case exceeded:
+		os.Exit(exitProblems)
+	case failed != 0:
+		os.Exit(exitPartial)
+	}
+}
+
+// severity colors, from least to most severe
+var severityColors = map[audit.Severity]func(string) string{
+	audit.Low:      color.Meta,
+	audit.Medium:   color.Warning,
+	audit.High:     color.Error,
+	audit.Critical: color.Error,
+}
+
+// printFindings displays the findings for the package name.
+func printFindings(name string, findings []audit.Finding) {
+	fmt.Printf("%s %s: %d findings\n", color.Group("==>"), color.Title(name), len(findings))
+	for _, f := range findings {
+		severity := severityColors[f.Severity](fmt.Sprintf("%-8s", strings.ToUpper(f.Severity.String())))
+		fmt.Printf("  %s %s:%d %s: %s\n", severity, f.File, f.Line, color.Title(f.Rule), f.Message)
+		fmt.Printf("           %s\n", f.Text)
+	}
+}
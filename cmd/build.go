@@ -0,0 +1,570 @@
+/*
+ * build.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
+	"github.com/bmoller/pkg/srcinfo"
+	"github.com/bmoller/pkg/vcs"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build package...",
+	Short: "Build AUR packages and their AUR dependencies with makepkg",
+	Long: `The build command builds the requested AUR packages with makepkg. Each package's
+snapshot is fetched into a directory named for its package base under the build
+directory, or reused if that directory already exists.
+
+Dependencies, build dependencies and check dependencies that are neither
+installed nor available from a sync repository are looked up on the AUR and
+built first, in dependency order. A dependency without an AUR package of its
+name is built from an AUR package providing it, preferring one already being
+built and then the one with the most votes. Packages that others depend on are
+installed once built, with 'makepkg --install', so the packages requiring them
+can be built; those not requested explicitly are installed with --asdeps.
+
+With --chroot each package is built in a clean chroot instead, as devtools'
+makechrootpkg does. A build root containing base-devel is created with
+mkarchroot in the chroot directory from the sync repositories of pacman.conf,
+or updated if it already exists, and reused by later builds. Each package is
+built in a fresh copy of the build root, into which the packages built earlier
+for its dependencies are installed; nothing is installed on the host, and only
+dependencies available from the sync repositories count as satisfied.
+The devtools package provides mkarchroot, arch-nspawn and makechrootpkg.
+
+The output of makepkg is displayed and saved to a log file per package base in
+the log directory. A summary of each build and the package files it produced is
+displayed once all builds finish. If a build fails, packages depending on it
+are skipped; the exit status is 2 if some packages were built and 1 if none
+were.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  build,
+}
+
+var buildDirFlag = ""
+var buildLogDirFlag = ""
+var buildMakepkgFlag = "makepkg"
+var buildFlagsFlag = ""
+var buildMakeflagsFlag = ""
+var buildChrootFlag = false
+var buildChrootDirFlag = ""
+var buildChrootPackagesFlag = "base-devel"
+var buildPacmanConfigFlag = libalpm.DefaultConfig
+
+func init() {
+	flags := buildCmd.PersistentFlags()
+	flags.StringVarP(&buildDirFlag, "dir", "d", "", "Directory to build in (default $XDG_CACHE_HOME/pkg/build)")
+	flags.StringVar(&buildLogDirFlag, "log-dir", "", "Directory to save build logs in (default $XDG_STATE_HOME/pkg/logs)")
+	flags.StringVar(&buildMakepkgFlag, "makepkg", "makepkg", "makepkg command to run")
+	flags.StringVarP(&buildFlagsFlag, "makepkg-flags", "f", "--syncdeps", "Flags passed to every makepkg invocation")
+	flags.StringVar(&buildMakeflagsFlag, "makeflags", "", "MAKEFLAGS for the builds, e.g. -j8")
+	flags.BoolVarP(&buildChrootFlag, "chroot", "c", false, "Build in a clean chroot")
+	flags.StringVar(&buildChrootDirFlag, "chroot-dir", "", "Directory holding the clean chroot (default $XDG_CACHE_HOME/pkg/chroot)")
+	flags.StringVar(&buildChrootPackagesFlag, "chroot-packages", "base-devel", "Packages installed when creating the chroot")
+	flags.StringVar(&buildPacmanConfigFlag, "pacman-config", libalpm.DefaultConfig, "pacman configuration providing the chroot's sync repositories")
+}
+
+/*
+A buildTarget is a package base to build.
+*/
+type buildTarget struct {
+	Base       string   // package base
+	Names      []string // packages of the base that are needed
+	After      []string // package bases that must be built first
+	Dependency bool     // the base is only built to satisfy a dependency, not requested explicitly
+	Install    bool     // other bases depend on this one, so it is installed once built
+}
+
+/*
+A buildResult records the outcome of building a package base.
+*/
+type buildResult struct {
+	Base     string
+	Status   string // "built", "failed", or "skipped"
+	Error    string
+	Duration time.Duration
+	Log      string   // path of the build log
+	Packages []string // package files produced
+}
+
+/*
+An aurLookup finds the details of packages on the AUR.
+*/
+type aurLookup struct {
+	Info   func(names []string) ([]aur.Package, error)                    // details of packages by name
+	Search func(keyword string, by aur.SearchType) ([]aur.Package, error) // packages matching a search, without details
+}
+
+// lookup from the AUR itself
+var aurAPI = aurLookup{Info: aur.Info, Search: aur.Search}
+
+/*
+resolveBuild looks up the requested packages and their unsatisfied dependencies on the AUR.
+A dependency is satisfied if a sync repository package, or an installed package if local is set, has its name or provides it.
+The package bases to build are returned in an order where every base follows those it depends on.
+*/
+func resolveBuild(names []string, local bool) (order []*buildTarget, err error) {
+	satisfied, err := satisfiedDependencies(local)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveTargets(names, satisfied, aurAPI)
+}
+
+/*
+resolveTargets looks up the requested packages and the dependencies not in satisfied using lookup.
+A dependency without a package of its name is built from an AUR package providing it,
+preferring one already being built, then the one with the most votes.
+The package bases to build are returned in an order where every base follows those it depends on.
+*/
+func resolveTargets(names []string, satisfied map[string]bool, lookup aurLookup) (order []*buildTarget, err error) {
+	targets := make(map[string]*buildTarget)
+	provider := make(map[string]string)   // package name or provided dependency to package base
+	requiredBy := make(map[string]string) // dependency to the first package requiring it
+	needs := make(map[string][]string)    // package base to its unsatisfied dependencies
+	pending := slices.Clone(names)
+	for len(pending) != 0 {
+		var batch []string
+		for _, name := range pending {
+			if _, ok := provider[name]; !ok && !slices.Contains(batch, name) {
+				batch = append(batch, name)
+			}
+		}
+		pending = nil
+		if len(batch) == 0 {
+			break
+		}
+
+		var found []aur.Package
+		for chunk := range slices.Chunk(batch, infoBatchSize) {
+			results, err := lookup.Info(chunk)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, results...)
+		}
+		for _, name := range batch {
+			if _, ok := provider[name]; ok && !slices.Contains(names, name) {
+				// provided by a package resolved earlier in the batch
+				continue
+			}
+			var p aur.Package
+			if i := slices.IndexFunc(found, func(p aur.Package) bool { return p.Name == name }); i >= 0 {
+				p = found[i]
+			} else if requiredBy[name] == "" {
+				return nil, fmt.Errorf("no package with matching name '%s' found", name)
+			} else if p, err = findProvider(name, targets, lookup); err != nil {
+				return nil, fmt.Errorf("dependency '%s' of '%s' cannot be satisfied: %w", name, requiredBy[name], err)
+			}
+			provider[name] = p.PackageBase
+			t, ok := targets[p.PackageBase]
+			if !ok {
+				t = &buildTarget{Base: p.PackageBase, Dependency: true}
+				targets[p.PackageBase] = t
+			}
+			t.Dependency = t.Dependency && !slices.Contains(names, name)
+			if slices.Contains(t.Names, p.Name) {
+				continue
+			}
+			t.Names = append(t.Names, p.Name)
+			provider[p.Name] = p.PackageBase
+			for _, provides := range p.Provides {
+				if dep := libalpm.DependencyName(provides); provider[dep] == "" {
+					provider[dep] = p.PackageBase
+				}
+			}
+
+			for _, dep := range slices.Concat(p.Depends, p.MakeDepends, p.CheckDepends) {
+				dep = libalpm.DependencyName(dep)
+				if satisfied[dep] {
+					continue
+				}
+				if _, ok := requiredBy[dep]; !ok {
+					requiredBy[dep] = p.Name
+				}
+				needs[p.PackageBase] = append(needs[p.PackageBase], dep)
+				pending = append(pending, dep)
+			}
+		}
+	}
+
+	// record the order constraints now that every provider is known
+	for base, deps := range needs {
+		t := targets[base]
+		for _, dep := range deps {
+			if after := provider[dep]; after != base && !slices.Contains(t.After, after) {
+				t.After = append(t.After, after)
+				targets[after].Install = true
+			}
+		}
+	}
+
+	// depth-first topological sort, visiting bases in name order for stable output
+	state := make(map[string]int) // 1 while visiting, 2 once ordered
+	var visit func(base string, path []string) error
+	visit = func(base string, path []string) error {
+		switch state[base] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, base), " -> "))
+		case 2:
+			return nil
+		}
+		state[base] = 1
+		after := slices.Sorted(slices.Values(targets[base].After))
+		for _, dep := range after {
+			if err := visit(dep, append(path, base)); err != nil {
+				return err
+			}
+		}
+		state[base] = 2
+		order = append(order, targets[base])
+		return nil
+	}
+	for _, base := range slices.Sorted(maps.Keys(targets)) {
+		if err := visit(base, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+/*
+findProvider looks up the AUR packages providing dep and returns the details of the one to build.
+A package whose base is already among targets is preferred, then the package with the most votes.
+*/
+func findProvider(dep string, targets map[string]*buildTarget, lookup aurLookup) (p aur.Package, err error) {
+	results, err := lookup.Search(dep, aur.Provides)
+	if err != nil {
+		return p, err
+	}
+	if len(results) == 0 {
+		return p, fmt.Errorf("no package provides it")
+	}
+	best := slices.MaxFunc(results, func(a, b aur.Package) int {
+		_, aTarget := targets[a.PackageBase]
+		_, bTarget := targets[b.PackageBase]
+		switch {
+		case aTarget != bTarget && aTarget:
+			return 1
+		case aTarget != bTarget:
+			return -1
+		case a.NumVotes != b.NumVotes:
+			return cmp.Compare(a.NumVotes, b.NumVotes)
+		default:
+			return cmp.Compare(b.Name, a.Name)
+		}
+	})
+
+	found, err := lookup.Info([]string{best.Name})
+	if err != nil {
+		return p, err
+	}
+	if len(found) == 0 {
+		return p, fmt.Errorf("provider '%s' not found", best.Name)
+	}
+
+	return found[0], nil
+}
+
+/*
+satisfiedDependencies returns the names of sync repository packages, and installed packages if local is set,
+along with everything they provide.
+*/
+func satisfiedDependencies(local bool) (satisfied map[string]bool, err error) {
+	installed := make(map[string]libalpm.Package)
+	if local {
+		if installed, err = libalpm.GetLocalPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath); err != nil {
+			return nil, err
+		}
+	}
+	repos, err := libalpm.GetConfigRepos(libalpm.DefaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	sync, err := libalpm.GetSyncPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath, libalpm.CheckSyncDBs(repos, libalpm.DefaultDBPath))
+	if err != nil {
+		return nil, err
+	}
+
+	satisfied = make(map[string]bool)
+	for _, p := range slices.Concat(slices.Collect(maps.Values(installed)), sync) {
+		satisfied[p.Name] = true
+		for _, provides := range p.Provides {
+			satisfied[libalpm.DependencyName(provides)] = true
+		}
+	}
+
+	return
+}
+
+/*
+runLogged runs the command name in dir with args, writing its output to stdout and to the file at logPath.
+*/
+func runLogged(dir, logPath, name string, args ...string) error {
+	log, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create build log: %w", err)
+	}
+	defer log.Close()
+
+	c := exec.Command(name, args...)
+	c.Dir = dir
+	c.Stdin = os.Stdin
+	c.Stdout = io.MultiWriter(buildOutput(), log)
+	c.Stderr = io.MultiWriter(os.Stderr, log)
+	c.Env = os.Environ()
+	if buildMakeflagsFlag != "" {
+		c.Env = append(c.Env, "MAKEFLAGS="+buildMakeflagsFlag)
+	}
+	if err = c.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return nil
+}
+
+// buildOutput is where build progress is written, keeping stdout free for machine-readable results.
+func buildOutput() io.Writer {
+	if machineOutput() {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+/*
+packageList asks makepkg for the package files a build in dir produces and returns those that exist.
+*/
+func packageList(dir string) (files []string, err error) {
+	c := exec.Command(buildMakepkgFlag, "--packagelist")
+	c.Dir = dir
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --packagelist failed: %w", buildMakepkgFlag, err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		if file := strings.TrimSpace(scanner.Text()); file != "" {
+			if _, err := os.Stat(file); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+
+	return
+}
+
+/*
+buildTargetIn fetches the snapshot of t into buildDir if needed and builds it, logging to logDir.
+If chrootDir is set the build runs in a clean chroot there, with the package files in install installed first.
+*/
+func buildTargetIn(t *buildTarget, buildDir, logDir, chrootDir string, install []string) (r buildResult) {
+	r = buildResult{Base: t.Base, Status: "failed", Log: filepath.Join(logDir, t.Base+".log")}
+	start := time.Now()
+	defer func() { r.Duration = time.Since(start).Round(time.Second) }()
+
+	dir := filepath.Join(buildDir, t.Base)
+	if _, err := os.Stat(filepath.Join(dir, "PKGBUILD")); os.IsNotExist(err) {
+		fmt.Fprintf(buildOutput(), "%s %s\n", color.Group("==> Fetching"), color.Title(t.Base))
+		if err := fetchPackage(t.Names[0], buildDir); err != nil {
+			r.Error = err.Error()
+			return
+		}
+	}
+
+	fmt.Fprintf(buildOutput(), "%s %s\n", color.Group("==> Building"), color.Title(t.Base))
+	var err error
+	if chrootDir != "" {
+		err = runLogged(dir, r.Log, makechrootpkg, chrootArgs(chrootDir, install)...)
+	} else {
+		args := strings.Fields(buildFlagsFlag)
+		if t.Install {
+			args = append(args, "--install")
+		}
+		if t.Install && t.Dependency {
+			args = append(args, "--asdeps")
+		}
+		err = runLogged(dir, r.Log, buildMakepkgFlag, args...)
+	}
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	files, err := packageList(dir)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.Status, r.Packages = "built", files
+
+	// later devel update checks compare against the sources just built
+	if info, err := srcinfo.ParseFile(filepath.Join(dir, ".SRCINFO")); err == nil {
+		for _, name := range t.Names {
+			if vcs.IsDevel(name) {
+				if err := recordDevelHeads(name, vcsSources(info)); err != nil {
+					fmt.Fprintf(buildOutput(), "warning: %s\n", err)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func build(cmd *cobra.Command, args []string) {
+	buildDir, logDir, chrootDir := buildDirFlag, buildLogDirFlag, buildChrootDirFlag
+	var err error
+	if buildDir == "" {
+		buildDir, err = defaultBuildDir()
+	}
+	if err == nil && buildChrootFlag && chrootDir == "" {
+		if chrootDir, err = cacheDir(); err == nil {
+			chrootDir = filepath.Join(chrootDir, "chroot")
+		}
+	}
+	if err == nil && logDir == "" {
+		if logDir, err = stateDir(); err == nil {
+			logDir = filepath.Join(logDir, "logs")
+		}
+	}
+	if err == nil {
+		err = os.MkdirAll(buildDir, 0755)
+	}
+	if err == nil {
+		err = os.MkdirAll(logDir, 0755)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	order, err := resolveBuild(args, !buildChrootFlag)
+	if err == nil && buildChrootFlag {
+		err = prepareChroot(chrootDir, filepath.Join(logDir, "chroot.log"))
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	var bases []string
+	for _, t := range order {
+		bases = append(bases, t.Base)
+	}
+	fmt.Fprintf(buildOutput(), "%s %s\n", color.Group("==> Build order:"), strings.Join(bases, " "))
+
+	var results []buildResult
+	failed := make(map[string]bool)
+	built := make(map[string][]string) // package files by base, installed into chroots for dependent builds
+	for _, t := range order {
+		if i := slices.IndexFunc(t.After, func(base string) bool { return failed[base] }); i >= 0 {
+			results = append(results, buildResult{Base: t.Base, Status: "skipped", Error: "dependency " + t.After[i] + " failed"})
+			failed[t.Base] = true
+			continue
+		}
+		var install []string
+		if buildChrootFlag {
+			install = dependencyFiles(t, order, built)
+		}
+		r := buildTargetIn(t, buildDir, logDir, chrootDir, install)
+		failed[t.Base] = r.Status != "built"
+		built[t.Base] = r.Packages
+		results = append(results, r)
+	}
+
+	if machineOutput() {
+		printResults(results)
+	} else {
+		printBuildSummary(results)
+	}
+	switch built := slices.ContainsFunc(results, func(r buildResult) bool { return r.Status == "built" }); {
+	case !slices.ContainsFunc(results, func(r buildResult) bool { return r.Status != "built" }):
+	case built:
+		os.Exit(exitPartial)
+	default:
+		os.Exit(exitError)
+	}
+}
+
+/*
+dependencyFiles returns the package files built for the bases t depends on, directly or indirectly.
+*/
+func dependencyFiles(t *buildTarget, order []*buildTarget, built map[string][]string) (files []string) {
+	seen := make(map[string]bool)
+	var visit func(t *buildTarget)
+	visit = func(t *buildTarget) {
+		for _, base := range t.After {
+			if seen[base] {
+				continue
+			}
+			seen[base] = true
+			files = append(files, built[base]...)
+			if i := slices.IndexFunc(order, func(t *buildTarget) bool { return t.Base == base }); i >= 0 {
+				visit(order[i])
+			}
+		}
+	}
+	visit(t)
+
+	return
+}
+
+// printBuildSummary displays the outcome of each build and the package files produced.
+func printBuildSummary(results []buildResult) {
+	fmt.Println(color.Group("==> Build summary:"))
+	for _, r := range results {
+		status := color.Version(r.Status)
+		if r.Status != "built" {
+			status = color.Error(r.Status)
+		}
+		fmt.Printf("    %s %s", color.Title(r.Base), status)
+		if r.Duration != 0 {
+			fmt.Printf(" in %s", r.Duration)
+		}
+		if r.Error != "" {
+			fmt.Printf(": %s", r.Error)
+		}
+		fmt.Println()
+		if r.Log != "" && r.Status == "failed" {
+			fmt.Printf("        log: %s\n", r.Log)
+		}
+		for _, file := range r.Packages {
+			fmt.Printf("        %s\n", file)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * build_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bmoller/pkg/aur"
+)
+
+// fakeAUR answers lookups from a fixed set of packages, recording the searches made.
+type fakeAUR struct {
+	packages []aur.Package
+	searches []string
+}
+
+func (f *fakeAUR) lookup() aurLookup {
+	return aurLookup{
+		Info: func(names []string) (found []aur.Package, err error) {
+			for _, p := range f.packages {
+				if slices.Contains(names, p.Name) {
+					found = append(found, p)
+				}
+			}
+			return
+		},
+		Search: func(keyword string, by aur.SearchType) (found []aur.Package, err error) {
+			if by != aur.Provides {
+				return nil, fmt.Errorf("unexpected search type %d", by)
+			}
+			f.searches = append(f.searches, keyword)
+			for _, p := range f.packages {
+				if p.Name == keyword || slices.ContainsFunc(p.Provides, func(s string) bool { return strings.HasPrefix(s, keyword) }) {
+					found = append(found, aur.Package{Name: p.Name, PackageBase: p.PackageBase, NumVotes: p.NumVotes})
+				}
+			}
+			return
+		},
+	}
+}
+
+func TestResolveTargets(t *testing.T) {
+	f := &fakeAUR{packages: []aur.Package{
+		{Name: "app", PackageBase: "app", Depends: []string{"glibc", "libfoo>=1.0", "virtual"}, MakeDepends: []string{"bar-headers"}},
+		{Name: "libfoo", PackageBase: "foo", Depends: []string{"glibc"}},
+		{Name: "impl-a", PackageBase: "impl-a", NumVotes: 10, Provides: []string{"virtual=1"}},
+		{Name: "impl-b", PackageBase: "impl-b", NumVotes: 20, Provides: []string{"virtual=2"}, Depends: []string{"libfoo"}},
+		{Name: "libbar", PackageBase: "bar", Provides: []string{"bar-headers"}},
+	}}
+	order, err := resolveTargets([]string{"app", "libbar"}, map[string]bool{"glibc": true}, f.lookup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bases []string
+	for _, target := range order {
+		bases = append(bases, target.Base)
+	}
+	if want := []string{"bar", "foo", "impl-b", "app"}; !slices.Equal(bases, want) {
+		t.Errorf("build order = %q, want %q", bases, want)
+	}
+	// bar is requested but app depends on it, so it is installed without --asdeps
+	for _, target := range order {
+		if want := target.Base == "foo" || target.Base == "impl-b"; target.Dependency != want {
+			t.Errorf("%s Dependency = %v, want %v", target.Base, target.Dependency, want)
+		}
+		if want := target.Base != "app"; target.Install != want {
+			t.Errorf("%s Install = %v, want %v", target.Base, target.Install, want)
+		}
+	}
+	if i := slices.IndexFunc(order, func(target *buildTarget) bool { return target.Base == "impl-b" }); !slices.Equal(order[i].Names, []string{"impl-b"}) {
+		t.Errorf("impl-b builds %q, want the providing package", order[i].Names)
+	}
+	// bar-headers is provided by a package already being built, so no search is needed
+	if want := []string{"virtual"}; !slices.Equal(f.searches, want) {
+		t.Errorf("searched providers of %q, want %q", f.searches, want)
+	}
+}
+
+func TestResolveTargetsErrors(t *testing.T) {
+	f := &fakeAUR{packages: []aur.Package{
+		{Name: "app", PackageBase: "app", Depends: []string{"missing-dep"}},
+		{Name: "cycle-a", PackageBase: "cycle-a", Depends: []string{"cycle-b"}},
+		{Name: "cycle-b", PackageBase: "cycle-b", Depends: []string{"cycle-a"}},
+	}}
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"missing"}, "no package with matching name 'missing' found"},
+		{[]string{"app"}, "dependency 'missing-dep' of 'app' cannot be satisfied: no package provides it"},
+		{[]string{"cycle-a"}, "dependency cycle: cycle-a -> cycle-b -> cycle-a"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, " "), func(t *testing.T) {
+			_, err := resolveTargets(tt.names, nil, f.lookup())
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("resolveTargets() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// stubMakepkg is a makepkg stand-in that records its arguments, writes a package file, and fails if FAIL exists.
+const stubMakepkg = `#!/bin/sh
+if [ "$1" = "--packagelist" ]; then
+	echo "$PWD/stub-1-1-any.pkg.tar.zst"
+	exit 0
+fi
+echo "$@" >> "$PWD/args"
+echo "building in $PWD"
+[ -e FAIL ] && exit 1
+touch "$PWD/stub-1-1-any.pkg.tar.zst"
+`
+
+func TestBuildTargetIn(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "makepkg"), []byte(stubMakepkg), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	makepkg, flags := buildMakepkgFlag, buildFlagsFlag
+	buildMakepkgFlag, buildFlagsFlag = "makepkg", "--syncdeps"
+	t.Cleanup(func() { buildMakepkgFlag, buildFlagsFlag = makepkg, flags })
+
+	tests := []struct {
+		name       string
+		install    bool
+		dependency bool
+		fail       bool
+		status     string
+		args       string
+	}{
+		{"explicit", false, false, false, "built", "--syncdeps"},
+		{"explicit dependency", true, false, false, "built", "--syncdeps --install"},
+		{"dependency", true, true, false, "built", "--syncdeps --install --asdeps"},
+		{"failure", false, false, true, "failed", "--syncdeps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildDir, logDir := t.TempDir(), t.TempDir()
+			dir := filepath.Join(buildDir, "stub")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			files := []string{"PKGBUILD"}
+			if tt.fail {
+				files = append(files, "FAIL")
+			}
+			for _, name := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := buildTargetIn(&buildTarget{Base: "stub", Names: []string{"stub"}, Install: tt.install, Dependency: tt.dependency}, buildDir, logDir, "", nil)
+			if r.Status != tt.status {
+				t.Errorf("Status = %s, want %s (%s)", r.Status, tt.status, r.Error)
+			}
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(args)); got != tt.args {
+				t.Errorf("makepkg called with %q, want %q", got, tt.args)
+			}
+			log, err := os.ReadFile(r.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(log), "building in "+dir) {
+				t.Errorf("build log %q is missing the makepkg output", log)
+			}
+
+			if tt.fail {
+				if !strings.Contains(r.Error, "makepkg failed") || len(r.Packages) != 0 {
+					t.Errorf("failed build = %+v", r)
+				}
+			} else if want := []string{filepath.Join(dir, "stub-1-1-any.pkg.tar.zst")}; !slices.Equal(r.Packages, want) {
+				t.Errorf("Packages = %q, want %q", r.Packages, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * chroot.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmoller/pkg/color"
+)
+
+// devtools commands used to create, update, and build in clean chroots
+const (
+	mkarchroot    = "mkarchroot"
+	archNspawn    = "arch-nspawn"
+	makechrootpkg = "makechrootpkg"
+)
+
+// name of the pristine build root in the chroot directory; working copies are made beside it
+const chrootRoot = "root"
+
+// file devtools creates in a build root once it is set up
+const chrootMarker = ".arch-chroot"
+
+/*
+prepareChroot creates the clean build root in dir, or updates it if it already exists,
+using the sync repositories configured in pacman.conf. Output is logged to logPath.
+*/
+func prepareChroot(dir, logPath string) error {
+	root := filepath.Join(dir, chrootRoot)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create chroot directory: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, chrootMarker)); os.IsNotExist(err) {
+		fmt.Fprintf(buildOutput(), "%s %s\n", color.Group("==> Creating build root"), root)
+		args := []string{"-C", buildPacmanConfigFlag, root}
+		return runLogged(dir, logPath, mkarchroot, append(args, strings.Fields(buildChrootPackagesFlag)...)...)
+	}
+
+	fmt.Fprintf(buildOutput(), "%s %s\n", color.Group("==> Updating build root"), root)
+	return runLogged(dir, logPath, archNspawn, "-C", buildPacmanConfigFlag, root, "pacman", "-Syuu", "--noconfirm")
+}
+
+/*
+chrootArgs builds the makechrootpkg arguments to build in a copy of the build root in chrootDir.
+The package files in install, built earlier for dependencies, are installed in the copy first.
+The copy is reset from the build root before each build so builds cannot affect each other.
+*/
+func chrootArgs(chrootDir string, install []string) []string {
+	args := []string{"-c", "-r", chrootDir}
+	for _, file := range install {
+		args = append(args, "-I", file)
+	}
+	args = append(args, "--")
+
+	return append(args, strings.Fields(buildFlagsFlag)...)
+}
@@ -0,0 +1,215 @@
+/*
+ * devel.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/srcinfo"
+	"github.com/bmoller/pkg/vcs"
+)
+
+// name of the record holding the upstream heads of built VCS packages
+const develRecord = "vcs-heads"
+
+/*
+A develUpdate is a VCS package whose upstream has moved since it was built.
+*/
+type develUpdate struct {
+	Name     string
+	Version  string
+	URL      string // upstream repository that changed
+	Built    string // head recorded when the package was built
+	Upstream string // current upstream head
+}
+
+/*
+loadDevelRecords reads the recorded upstream heads of built VCS packages.
+Keys are the package name and source URL separated by a space.
+*/
+func loadDevelRecords() (records map[string]string, err error) {
+	entries, err := readRecord(develRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	records = make(map[string]string)
+	for _, entry := range entries {
+		if fields := strings.Fields(entry); len(fields) == 3 {
+			records[fields[0]+" "+fields[1]] = fields[2]
+		}
+	}
+
+	return
+}
+
+// saveDevelRecords replaces the recorded upstream heads of built VCS packages.
+func saveDevelRecords(records map[string]string) error {
+	var entries []string
+	for _, key := range slices.Sorted(maps.Keys(records)) {
+		entries = append(entries, key+" "+records[key])
+	}
+
+	return writeRecord(develRecord, entries)
+}
+
+/*
+hostArch returns the architecture name used by pacman for the running system.
+*/
+func hostArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "riscv64":
+		return "riscv64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+/*
+develSources reads the supported VCS sources of a package base from the .SRCINFO of its snapshot fetched into dir.
+If the package base has not been fetched there, its .SRCINFO on the AUR is read instead.
+*/
+func develSources(dir, pkgbase string) (sources []vcs.Source, err error) {
+	info, err := srcinfo.ParseFile(filepath.Join(dir, pkgbase, ".SRCINFO"))
+	if errors.Is(err, os.ErrNotExist) {
+		var contents []byte
+		if contents, err = aur.GetFile(pkgbase, ".SRCINFO"); err != nil {
+			return nil, err
+		}
+		info, err = srcinfo.Parse(bytes.NewReader(contents))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse .SRCINFO for '%s': %w", pkgbase, err)
+	}
+
+	return vcsSources(info), nil
+}
+
+// vcsSources returns the sources of info for the host architecture with a supported VCS.
+func vcsSources(info *srcinfo.SrcInfo) (sources []vcs.Source) {
+	for _, entry := range info.Architecture("source", hostArch()) {
+		if s := vcs.ParseSource(entry); s.Supported() {
+			sources = append(sources, s)
+		}
+	}
+
+	return
+}
+
+/*
+recordDevelHeads stores the current upstream heads of sources as those built for the package name.
+*/
+func recordDevelHeads(name string, sources []vcs.Source) error {
+	records, err := loadDevelRecords()
+	if err != nil {
+		return err
+	}
+	for _, s := range sources {
+		head, err := s.Head()
+		if err != nil {
+			return err
+		}
+		records[name+" "+s.URL] = head
+	}
+
+	return saveDevelRecords(records)
+}
+
+/*
+checkDevelUpdates queries the upstream repositories of installed VCS packages for changes,
+reading their sources from the snapshots fetched into buildDir where available.
+A source without a recorded head is compared against the revision in the installed version,
+following the pkgver formats of the VCS package guidelines, which is then recorded.
+Packages with such a source whose revision cannot be determined are returned in unknown.
+Errors for individual packages are reported and do not stop the check; failed counts them.
+*/
+func checkDevelUpdates(pkgs []foreignPackage, buildDir string) (updates []develUpdate, unknown []string, failed int, err error) {
+	records, err := loadDevelRecords()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	for _, p := range pkgs {
+		if p.PackageBase == "" || !vcs.IsDevel(p.Name) {
+			continue
+		}
+		sources, err := develSources(buildDir, p.PackageBase)
+		if err != nil {
+			fmt.Println(err)
+			failed += 1
+			continue
+		}
+		for i, s := range sources {
+			head, err := s.Head()
+			if err != nil {
+				fmt.Println(err)
+				failed += 1
+				continue
+			}
+			key := p.Name + " " + s.URL
+			built, ok := records[key]
+			if !ok {
+				// only the first VCS source determines the pkgver
+				if i == 0 {
+					built = s.Revision(p.Version)
+				}
+				if built == "" {
+					if !slices.Contains(unknown, p.Name) {
+						unknown = append(unknown, p.Name)
+					}
+					continue
+				}
+				if s.SameRevision(built, head) {
+					built = head
+				}
+				records[key] = built
+			}
+			if !s.SameRevision(built, head) {
+				updates = append(updates, develUpdate{p.Name, p.Version, s.URL, built, head})
+			}
+		}
+	}
+
+	return updates, unknown, failed, saveDevelRecords(records)
+}
+
+// shortHead abbreviates long commit hashes for display.
+func shortHead(head string) string {
+	if len(head) > 12 {
+		return head[:12]
+	}
+
+	return head
+}
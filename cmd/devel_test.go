@@ -0,0 +1,150 @@
+/*
+ * devel_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bmoller/pkg/srcinfo"
+)
+
+// gitUpstream creates a git repository in a temporary directory holding a single commit.
+func gitUpstream(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	gitCommit(t, dir)
+
+	return dir
+}
+
+// gitCommit adds an empty commit to the repository in dir and returns its hash.
+func gitCommit(t *testing.T, dir string) string {
+	t.Helper()
+	runGit(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "--message=test")
+
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+// runGit runs a git command in dir and returns its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// writeSrcInfo saves a .SRCINFO for pkgbase with the given sources as if fetched into buildDir.
+func writeSrcInfo(t *testing.T, buildDir, pkgbase string, sources ...string) {
+	t.Helper()
+	contents := fmt.Sprintf("pkgbase = %s\n\tpkgver = r1.g0000000\n\tpkgrel = 1\n", pkgbase)
+	for _, s := range sources {
+		contents += "\tsource = " + s + "\n"
+	}
+	contents += "\npkgname = " + pkgbase + "\n"
+	if err := os.MkdirAll(filepath.Join(buildDir, pkgbase), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, pkgbase, ".SRCINFO"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckDevelUpdates(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	buildDir := t.TempDir()
+	upstream := gitUpstream(t)
+	head := runGit(t, upstream, "rev-parse", "HEAD")
+	source := "git+file://" + upstream
+	for _, base := range []string{"current-git", "stale-git", "unversioned-git"} {
+		writeSrcInfo(t, buildDir, base, source)
+	}
+	writeSrcInfo(t, buildDir, "second-git", source, "git+file://"+gitUpstream(t))
+
+	pkgs := []foreignPackage{
+		{Name: "current-git", PackageBase: "current-git", Version: "r1.g" + head[:7] + "-1"},
+		{Name: "stale-git", PackageBase: "stale-git", Version: "r1.g0123456-1"},
+		{Name: "unversioned-git", PackageBase: "unversioned-git", Version: "1.0-1"},
+		{Name: "second-git", PackageBase: "second-git", Version: "r1.g" + head[:7] + "-1"},
+		{Name: "release", PackageBase: "release", Version: "1.0-1"},
+	}
+	updates, unknown, failed, err := checkDevelUpdates(pkgs, buildDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 0 {
+		t.Errorf("failed = %d, want 0", failed)
+	}
+	if want := []string{"unversioned-git", "second-git"}; !slices.Equal(unknown, want) {
+		t.Errorf("unknown = %q, want %q", unknown, want)
+	}
+	if len(updates) != 1 || updates[0].Name != "stale-git" || updates[0].Built != "0123456" || updates[0].Upstream != head {
+		t.Errorf("updates = %+v, want stale-git from 0123456 to %s", updates, head)
+	}
+
+	// heads seeded from the installed versions are compared against on the next check
+	next := gitCommit(t, upstream)
+	updates, unknown, _, err = checkDevelUpdates(pkgs, buildDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range updates {
+		if u.Upstream != next {
+			t.Errorf("update of %s to %s, want %s", u.Name, u.Upstream, next)
+		}
+		names = append(names, u.Name)
+	}
+	if want := []string{"current-git", "stale-git", "second-git"}; !slices.Equal(names, want) {
+		t.Errorf("updated packages = %q, want %q", names, want)
+	}
+	if want := []string{"unversioned-git", "second-git"}; !slices.Equal(unknown, want) {
+		t.Errorf("unknown = %q, want %q", unknown, want)
+	}
+
+	// a build records the heads, after which the package is current
+	info, err := srcinfo.ParseFile(filepath.Join(buildDir, "unversioned-git", ".SRCINFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recordDevelHeads("unversioned-git", vcsSources(info)); err != nil {
+		t.Fatal(err)
+	}
+	updates, unknown, _, err = checkDevelUpdates(pkgs[2:3], buildDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 0 || len(unknown) != 0 {
+		t.Errorf("after recording, updates = %+v and unknown = %q, want none", updates, unknown)
+	}
+}
@@ -27,10 +27,13 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/srcinfo"
 )
 
 var fetchCmd = &cobra.Command{
@@ -44,50 +47,98 @@ unless otherwise specified.`,
 }
 
 func fetch(cmd *cobra.Command, args []string) {
-	filepath, err := aur.DownloadSnapshot(args[0])
-	if err != nil {
+	if err := fetchPackage(args[0], "."); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+}
+
+/*
+fetchPackage downloads the snapshot of the named package and extracts it into dest.
+The snapshot contains a single directory named for the package base.
+*/
+func fetchPackage(name, dest string) error {
+	archive, err := aur.DownloadSnapshot(name)
+	if err != nil {
+		return err
 	}
-	f, err := os.Open(filepath)
+	f, err := os.Open(archive)
 	if err != nil {
-		fmt.Printf("failed to open downloaded archive: %s\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to open downloaded archive: %w", err)
 	}
 	defer f.Close()
 	gzReader, err := gzip.NewReader(f)
 	if err != nil {
-		fmt.Printf("failed to decompress tarball: %s\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to decompress tarball: %w", err)
 	}
 	defer gzReader.Close()
 	tarReader := tar.NewReader(gzReader)
 
 	// iterate over tarball contents and extract the important bits
 	// we really only care about files, directories, and symlinks
-	for h, err := tarReader.Next(); err != io.EOF; h, err = tarReader.Next() {
+	base := ""
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if base == "" && (h.Typeflag == tar.TypeDir || h.Typeflag == tar.TypeReg) {
+			base, _, _ = strings.Cut(h.Name, "/")
+		}
+		target := filepath.Join(dest, h.Name)
 		switch h.Typeflag {
 		case tar.TypeDir:
-			if err := os.Mkdir(h.Name, fs.FileMode(h.Mode)); err != nil {
-				fmt.Printf("failed to create directory '%s': %s\n", h.Name, err)
-				os.Exit(1)
+			if err := os.Mkdir(target, fs.FileMode(h.Mode)); err != nil {
+				return fmt.Errorf("failed to create directory '%s': %w", target, err)
 			}
 		case tar.TypeReg:
-			if t, err := os.OpenFile(h.Name, os.O_CREATE|os.O_RDWR, fs.FileMode(h.Mode)); err != nil {
-				fmt.Printf("failed to open output file '%s': %s\n", h.Name, err)
-				os.Exit(1)
+			if t, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, fs.FileMode(h.Mode)); err != nil {
+				return fmt.Errorf("failed to open output file '%s': %w", target, err)
 			} else if _, err := t.ReadFrom(tarReader); err != nil && !errors.Is(err, io.EOF) {
-				fmt.Printf("failed to read data for output file '%s': %s\n", h.Name, err)
-				os.Exit(1)
+				t.Close()
+				return fmt.Errorf("failed to read data for output file '%s': %w", target, err)
 			} else if err := t.Close(); err != nil {
-				fmt.Printf("failed to close output file '%s': %s\n", h.Name, err)
-				os.Exit(1)
+				return fmt.Errorf("failed to close output file '%s': %w", target, err)
 			}
 		case tar.TypeSymlink:
-			if err := os.Symlink(h.Linkname, h.Name); err != nil {
-				fmt.Printf("failed to create symlink '%s': %s\n", h.Name, err)
-				os.Exit(1)
+			if err := os.Symlink(h.Linkname, target); err != nil {
+				return fmt.Errorf("failed to create symlink '%s': %w", target, err)
 			}
 		}
 	}
+
+	// remember the package came from the AUR in case it is later deleted there
+	if err := recordFetched(name, filepath.Join(dest, base)); err != nil {
+		fmt.Printf("warning: %s\n", err)
+	}
+
+	return nil
+}
+
+/*
+recordFetched adds name to the record of packages fetched from the AUR, along with the package base
+and every package built from it as listed by the .SRCINFO in dir, so split packages are recorded
+whichever of their names was fetched.
+*/
+func recordFetched(name, dir string) error {
+	names := []string{name}
+	info, err := srcinfo.ParseFile(filepath.Join(dir, ".SRCINFO"))
+	if err == nil {
+		names = append(names, info.Base.Name)
+		for _, p := range info.Packages {
+			names = append(names, p.Name)
+		}
+	}
+	for _, n := range names {
+		if recordErr := addRecord(fetchedRecord, n); recordErr != nil {
+			return recordErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("only recorded '%s' as fetched: %w", name, err)
+	}
+
+	return nil
 }
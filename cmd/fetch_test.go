@@ -0,0 +1,58 @@
+/*
+ * fetch_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRecordFetched(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "foo")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	srcinfo := "pkgbase = foo\n\tpkgver = 1.0\n\tpkgrel = 1\n\npkgname = foo-cli\n\npkgname = foo-lib\n"
+	if err := os.WriteFile(filepath.Join(dir, ".SRCINFO"), []byte(srcinfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// fetching one package of a split base records its siblings too
+	if err := recordFetched("foo-lib", dir); err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := readRecord(fetchedRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"foo-lib", "foo", "foo-cli"}; !slices.Equal(fetched, want) {
+		t.Errorf("fetched record = %q, want %q", fetched, want)
+	}
+
+	// without a .SRCINFO only the requested name is recorded
+	if err := recordFetched("bar", t.TempDir()); err == nil {
+		t.Error("recordFetched without a .SRCINFO did not report it")
+	}
+	if fetched, _ = readRecord(fetchedRecord); !slices.Equal(fetched, []string{"foo-lib", "foo", "foo-cli", "bar"}) {
+		t.Errorf("fetched record = %q, want bar added", fetched)
+	}
+}
@@ -27,26 +27,184 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
 	"github.com/bmoller/pkg/libalpm"
 )
 
 var foreignCmd = &cobra.Command{
 	Use:   "foreign",
-	Short: "List foreign packages",
+	Short: "List and classify foreign packages",
 	Long: `The foreign command lists locally-installed packages that are not found in any
-configured sync repository. This command is equivalent to 'pacman -Qm'.`,
-	Run: foreign,
+configured sync repository, similar to 'pacman -Qm'. Each package is looked up
+on the AUR and listed under one or more categories:
+
+  aur          available on the AUR
+  orphaned     available on the AUR but without a maintainer
+  out-of-date  flagged out-of-date on the AUR
+  deleted      previously fetched with pkg but no longer on the AUR
+  local        never seen on the AUR; a purely local build
+
+Only packages fetched with the fetch or build commands are known to have come
+from the AUR, so a package installed some other way that has since been
+deleted from the AUR is listed as local rather than deleted.
+
+Category flags restrict the listing to the selected categories. If some
+packages could not be looked up on the AUR they are not listed, and the exit
+status is 2.`,
+	Args: cobra.NoArgs,
+	Run:  foreign,
+}
+
+// foreign package categories in display order
+const (
+	classAUR       = "aur"
+	classOrphaned  = "orphaned"
+	classOutOfDate = "out-of-date"
+	classDeleted   = "deleted"
+	classLocal     = "local"
+)
+
+var foreignClasses = []string{classAUR, classOrphaned, classOutOfDate, classDeleted, classLocal}
+
+var foreignClassFlags = make(map[string]*bool)
+
+func init() {
+	for _, class := range foreignClasses {
+		foreignClassFlags[class] = foreignCmd.PersistentFlags().Bool(class, false, fmt.Sprintf("List %s packages", class))
+	}
+}
+
+// maximum number of packages requested from the AUR at once
+const infoBatchSize = 100
+
+/*
+A foreignPackage is a locally-installed foreign package and what the AUR knows about it.
+*/
+type foreignPackage struct {
+	Name        string
+	Version     string
+	PackageBase string   // AUR package base, if found
+	AURVersion  string   // version published on the AUR, if found
+	Maintainer  string   // AUR maintainer, if any
+	OutOfDate   int      // Unix timestamp of the out-of-date flag, if any
+	Classes     []string // categories the package belongs to
+}
+
+/*
+getForeignPackages finds the foreign packages of the local installation and classifies them using the AUR.
+Errors looking up packages on the AUR are reported and do not stop the lookup;
+the packages affected are left out of the results and counted in failed.
+Results are sorted by package name.
+*/
+func getForeignPackages() (pkgs []foreignPackage, failed int, err error) {
+	syncRepos, err := libalpm.GetConfigRepos(libalpm.DefaultConfig)
+	if err != nil {
+		return nil, 0, err
+	}
+	foreignPkgs, err := libalpm.GetForeignPackages(libalpm.DefaultRoot, libalpm.DefaultDBPath, syncRepos)
+	if err != nil {
+		return nil, 0, err
+	}
+	fetched, err := readRecord(fetchedRecord)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	names := slices.Sorted(maps.Keys(foreignPkgs))
+	found := make(map[string]foreignPackage)
+	unchecked := make(map[string]bool)
+	for batch := range slices.Chunk(names, infoBatchSize) {
+		results, err := aur.Info(batch)
+		if err != nil {
+			fmt.Println(err)
+			failed += len(batch)
+			for _, name := range batch {
+				unchecked[name] = true
+			}
+			continue
+		}
+		for _, r := range results {
+			found[r.Name] = foreignPackage{
+				PackageBase: r.PackageBase,
+				AURVersion:  r.Version,
+				Maintainer:  r.Maintainer,
+				OutOfDate:   r.OutOfDate,
+			}
+		}
+	}
+
+	for _, name := range names {
+		if unchecked[name] {
+			continue
+		}
+		p, ok := found[name]
+		p.Name, p.Version = name, foreignPkgs[name]
+		switch {
+		case ok:
+			p.Classes = append(p.Classes, classAUR)
+			if p.Maintainer == "" {
+				p.Classes = append(p.Classes, classOrphaned)
+			}
+			if p.OutOfDate != 0 {
+				p.Classes = append(p.Classes, classOutOfDate)
+			}
+		case slices.Contains(fetched, name):
+			p.Classes = append(p.Classes, classDeleted)
+		default:
+			p.Classes = append(p.Classes, classLocal)
+		}
+		pkgs = append(pkgs, p)
+	}
+
+	return
 }
 
 func foreign(cmd *cobra.Command, args []string) {
-	if pkgs, err := libalpm.GetForeignPackages("/", "/var/lib/pacman", []string{"core", "extra"}); err != nil {
+	pkgs, failed, err := getForeignPackages()
+	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+
+	// with no categories selected list all of them
+	selected := slices.DeleteFunc(slices.Clone(foreignClasses), func(class string) bool {
+		return !*foreignClassFlags[class]
+	})
+	if len(selected) == 0 {
+		selected = foreignClasses
+	}
+
+	if machineOutput() {
+		printResults(slices.DeleteFunc(pkgs, func(p foreignPackage) bool {
+			return !slices.ContainsFunc(p.Classes, func(class string) bool { return slices.Contains(selected, class) })
+		}))
 	} else {
-		names := slices.Collect(maps.Keys(pkgs))
-		slices.Sort(names)
-		for _, pkg := range names {
-			fmt.Printf("%s %s\n", pkg, pkgs[pkg])
+		printForeign(pkgs, selected, failed)
+	}
+	if failed != 0 {
+		os.Exit(exitPartial)
+	}
+}
+
+// printForeign lists the packages in each selected category, followed by the count of packages that could not be looked up.
+func printForeign(pkgs []foreignPackage, selected []string, failed int) {
+	for _, class := range selected {
+		var members []foreignPackage
+		for _, p := range pkgs {
+			if slices.Contains(p.Classes, class) {
+				members = append(members, p)
+			}
+		}
+		if len(members) == 0 {
+			continue
 		}
+		fmt.Printf("%s (%d):\n", color.Group(class), len(members))
+		for _, p := range members {
+			fmt.Printf("    %s %s\n", color.Title(p.Name), color.Version(p.Version))
+		}
+	}
+	if failed != 0 {
+		fmt.Printf("%d packages could not be looked up on the AUR.\n", failed)
 	}
 }
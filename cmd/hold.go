@@ -0,0 +1,262 @@
+/*
+ * hold.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/libalpm"
+)
+
+var holdCmd = &cobra.Command{
+	Use:   "hold [package...]",
+	Short: "Ignore updates to packages",
+	Long: `The hold command adds packages to pkg's ignore list, which is stored in the file
+'ignore' of pkg's configuration directory ($XDG_CONFIG_HOME/pkg). Updates to
+held packages are listed separately by the updates command. Package names may
+be shell globs such as 'python-*'. With --below, only updates to the given
+version or later are ignored. With no arguments the current list is displayed.
+
+Each line of the ignore file holds a package name or glob, optionally followed
+by '<' and a version:
+
+  foo
+  python-*
+  bar <2.0`,
+	Run: hold,
+}
+
+var unholdCmd = &cobra.Command{
+	Use:   "unhold package...",
+	Short: "Stop ignoring updates to packages",
+	Long: `The unhold command removes packages from pkg's ignore list. Names must match the
+entries as they were added, including any glob characters.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  unhold,
+}
+
+var holdBelowFlag = ""
+
+func init() {
+	holdCmd.PersistentFlags().StringVar(&holdBelowFlag, "below", "", "Only ignore updates to this version or later")
+}
+
+// name of the ignore file in the configuration directory
+const ignoreFile = "ignore"
+
+/*
+A holdRule ignores updates to packages matching Pattern.
+If Below is set, only updates to that version or later are ignored.
+*/
+type holdRule struct {
+	Pattern string
+	Below   string
+}
+
+func (r holdRule) String() string {
+	if r.Below != "" {
+		return r.Pattern + " <" + r.Below
+	}
+
+	return r.Pattern
+}
+
+/*
+holds reports whether the rule ignores an update of the package name to version.
+An empty version matches any rule without a version limit.
+*/
+func (r holdRule) holds(name, version string) bool {
+	if ok, _ := path.Match(r.Pattern, name); !ok {
+		return false
+	}
+	if r.Below == "" {
+		return true
+	}
+
+	return version != "" && libalpm.CompareVersions(version, r.Below) >= 0
+}
+
+/*
+loadHoldRules reads the ignore file from the configuration directory.
+Blank lines and comments starting with '#' are skipped.
+*/
+func loadHoldRules() (rules []holdRule, err error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(filepath.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+
+	for n, line := range strings.Split(string(contents), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		pattern, below, _ := strings.Cut(strings.TrimSpace(line), "<")
+		pattern, below = strings.TrimSpace(pattern), strings.TrimSpace(below)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("ignore file line %d: invalid pattern '%s'", n+1, pattern)
+		}
+		rules = append(rules, holdRule{pattern, below})
+	}
+
+	return
+}
+
+// saveHoldRules replaces the contents of the ignore file with rules.
+func saveHoldRules(rules []holdRule) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+
+	contents := ""
+	for _, r := range rules {
+		contents += r.String() + "\n"
+	}
+	if err = os.WriteFile(filepath.Join(dir, ignoreFile), []byte(contents), 0644); err != nil {
+		return fmt.Errorf("failed to write ignore file: %w", err)
+	}
+
+	return nil
+}
+
+/*
+An ignoreList combines pacman's IgnorePkg and IgnoreGroup settings with pkg's hold rules.
+*/
+type ignoreList struct {
+	packages []string            // IgnorePkg globs
+	groups   []string            // IgnoreGroup names
+	members  map[string][]string // groups of installed packages, loaded only if groups is set
+	rules    []holdRule
+}
+
+/*
+loadIgnoreList reads the ignore settings of pacman's configuration and pkg's ignore file.
+*/
+func loadIgnoreList() (ignores ignoreList, err error) {
+	options, err := libalpm.GetConfigOptions(libalpm.DefaultConfig)
+	if err != nil {
+		return ignoreList{}, err
+	}
+	ignores.packages = options["IgnorePkg"]
+	ignores.groups = options["IgnoreGroup"]
+	if len(ignores.groups) != 0 {
+		pkgs, err := libalpm.GetLocalPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath)
+		if err != nil {
+			return ignoreList{}, err
+		}
+		ignores.members = make(map[string][]string)
+		for name, p := range pkgs {
+			ignores.members[name] = p.Groups
+		}
+	}
+	if ignores.rules, err = loadHoldRules(); err != nil {
+		return ignoreList{}, err
+	}
+
+	return
+}
+
+/*
+reason returns why an update of the package name to version is ignored, or an empty string if it is not.
+*/
+func (l ignoreList) reason(name, version string) string {
+	for _, pattern := range l.packages {
+		if ok, _ := path.Match(pattern, name); ok {
+			return "IgnorePkg"
+		}
+	}
+	for _, group := range l.members[name] {
+		if slices.Contains(l.groups, group) {
+			return "IgnoreGroup " + group
+		}
+	}
+	for _, r := range l.rules {
+		if r.holds(name, version) {
+			return "held: " + r.String()
+		}
+	}
+
+	return ""
+}
+
+func hold(cmd *cobra.Command, args []string) {
+	rules, err := loadHoldRules()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if len(args) == 0 && machineOutput() {
+		printResults(rules)
+		return
+	} else if len(args) == 0 {
+		for _, r := range rules {
+			fmt.Println(r)
+		}
+		return
+	}
+
+	for _, pattern := range args {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Printf("Invalid package pattern: %s\n", pattern)
+			os.Exit(exitError)
+		}
+		// replace any existing rule for the same pattern
+		rules = slices.DeleteFunc(rules, func(r holdRule) bool { return r.Pattern == pattern })
+		rules = append(rules, holdRule{pattern, holdBelowFlag})
+	}
+	if err = saveHoldRules(rules); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+}
+
+func unhold(cmd *cobra.Command, args []string) {
+	rules, err := loadHoldRules()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	for _, pattern := range args {
+		if !slices.ContainsFunc(rules, func(r holdRule) bool { return r.Pattern == pattern }) {
+			fmt.Printf("Package '%s' is not held\n", pattern)
+			continue
+		}
+		rules = slices.DeleteFunc(rules, func(r holdRule) bool { return r.Pattern == pattern })
+	}
+	if err = saveHoldRules(rules); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+}
@@ -22,6 +22,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/spf13/cobra"
 
@@ -29,23 +30,86 @@ import (
 )
 
 var infoCmd = &cobra.Command{
-	Use:   "info package",
-	Short: "Display details of an AUR package",
-	Long: `The info command queries the AUR for details about a user-uploaded package. The
-information, if found, is formatted and displayed similar to pacman's output
-for official packages.`,
-	Args: cobra.ExactArgs(1),
+	Use:   "info package...",
+	Short: "Display details of AUR packages",
+	Long: `The info command queries the AUR for details about user-uploaded packages. The
+information for each package found is formatted and displayed similar to
+pacman's output for official packages, in the order requested. With --extended
+AUR-specific details such as the package base, submitter and co-maintainers are
+included. With --quiet only the names of found packages are printed.
+
+Every requested package not found on the AUR is reported after the details of
+the packages that were found. Dates are displayed in the local time zone using
+the date format of the locale set by LC_ALL, LC_TIME or LANG, as pacman does.
+
+The exit status is 0 if every package was found, 2 if some were not found, 3 if
+none were found, and 1 on any other error.`,
+	Args: cobra.MinimumNArgs(1),
 	Run:  info,
 }
 
+var infoQuietFlag = false
+var infoExtendedFlag = false
+
+func init() {
+	infoCmd.PersistentFlags().BoolVarP(&infoQuietFlag, "quiet", "q", false, "Print only the package names")
+	infoCmd.PersistentFlags().BoolVarP(&infoExtendedFlag, "extended", "i", false, "Include AUR-specific details")
+}
+
 func info(cmd *cobra.Command, args []string) {
-	switch results, err := aur.Info(args); {
-	case err != nil:
-		fmt.Println(err)
-		os.Exit(1)
-	case len(results) != 1:
-		fmt.Printf("No package with matching name '%s' found\n", args[0])
+	var results []aur.Package
+	for batch := range slices.Chunk(args, infoBatchSize) {
+		found, err := aur.Info(batch)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		results = append(results, found...)
+	}
+
+	// display packages in the order requested, skipping repeated names
+	var ordered []aur.Package
+	var missing []string
+	for _, name := range args {
+		i := slices.IndexFunc(results, func(p aur.Package) bool { return p.Name == name })
+		switch {
+		case i < 0 && !slices.Contains(missing, name):
+			missing = append(missing, name)
+		case i >= 0 && !slices.ContainsFunc(ordered, func(p aur.Package) bool { return p.Name == name }):
+			ordered = append(ordered, results[i])
+		}
+	}
+
+	switch {
+	case machineOutput():
+		printResults(ordered)
+	case infoQuietFlag:
+		for _, p := range ordered {
+			fmt.Println(p.Name)
+		}
 	default:
-		fmt.Print(results[0].Formatted())
+		for i, p := range ordered {
+			if i > 0 {
+				fmt.Println()
+			}
+			if infoExtendedFlag {
+				fmt.Print(p.FormattedExtended())
+			} else {
+				fmt.Print(p.Formatted())
+			}
+		}
+		if len(missing) != 0 && len(ordered) != 0 {
+			fmt.Println()
+		}
+		for _, name := range missing {
+			fmt.Printf("No package with matching name '%s' found\n", name)
+		}
+	}
+
+	switch {
+	case len(ordered) == 0:
+		os.Exit(exitNotFound)
+	case len(missing) != 0:
+		os.Exit(exitPartial)
 	}
 }
@@ -0,0 +1,247 @@
+/*
+ * inspect.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/archive"
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/format"
+	"github.com/bmoller/pkg/locale"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect package-file...",
+	Short: "Display the details and contents of built package files",
+	Long: `The inspect command reads pacman package files compressed with zstd, xz or gzip
+and displays the details recorded in their .PKGINFO and .BUILDINFO, similar to
+'pacman -Qip'. With --list the files the package installs are listed with their
+modes and sizes.
+
+With --aur the package's version, dependencies, provides, conflicts and
+replaces are compared with the AUR's metadata for the package of the same
+name, and any differences are listed. The exit status is 4 if differences are
+found, which makes --aur usable as a check on what a build produced.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  inspect,
+}
+
+var inspectListFlag = false
+var inspectAURFlag = false
+
+func init() {
+	inspectCmd.PersistentFlags().BoolVarP(&inspectListFlag, "list", "l", false, "List the files in the package")
+	inspectCmd.PersistentFlags().BoolVarP(&inspectAURFlag, "aur", "a", false, "Compare the package's metadata with the AUR's")
+}
+
+/*
+An inspection holds what was read from a package file.
+*/
+type inspection struct {
+	File        string
+	Info        *archive.Info
+	BuildInfo   *archive.BuildInfo
+	MTree       []archive.MTreeEntry
+	Install     string
+	Entries     []archive.Entry
+	Differences []metadataDifference
+}
+
+/*
+A metadataDifference is a value present in only one of a package file's metadata and the AUR's.
+*/
+type metadataDifference struct {
+	Field string // Version, Depends, MakeDepends, CheckDepends, OptDepends, Provides, Conflicts, or Replaces
+	Value string
+	Only  string // "package" or "aur"
+}
+
+/*
+compareMetadata lists the differences between the metadata of a package file and the AUR's metadata for the same package.
+*/
+func compareMetadata(info *archive.Info, p aur.Package) (differences []metadataDifference) {
+	if info.Version != p.Version {
+		differences = append(differences,
+			metadataDifference{"Version", info.Version, "package"},
+			metadataDifference{"Version", p.Version, "aur"})
+	}
+	fields := []struct {
+		name       string
+		local, aur []string
+	}{
+		{"Depends", info.Depends, p.Depends},
+		{"MakeDepends", info.MakeDepends, p.MakeDepends},
+		{"CheckDepends", info.CheckDepends, p.CheckDepends},
+		{"OptDepends", info.OptDepends, p.OptDepends},
+		{"Provides", info.Provides, p.Provides},
+		{"Conflicts", info.Conflicts, p.Conflicts},
+		{"Replaces", info.Replaces, p.Replaces},
+	}
+	for _, f := range fields {
+		for _, v := range f.local {
+			if !slices.Contains(f.aur, v) {
+				differences = append(differences, metadataDifference{f.name, v, "package"})
+			}
+		}
+		for _, v := range f.aur {
+			if !slices.Contains(f.local, v) {
+				differences = append(differences, metadataDifference{f.name, v, "aur"})
+			}
+		}
+	}
+
+	return
+}
+
+func inspect(cmd *cobra.Command, args []string) {
+	var results []inspection
+	failed := 0
+	for _, path := range args {
+		pkg, err := archive.Read(path)
+		if err != nil {
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		results = append(results, inspection{path, pkg.Info, pkg.BuildInfo, pkg.MTree, pkg.Install, pkg.Entries, nil})
+	}
+
+	if inspectAURFlag && len(results) != 0 {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Info.Name)
+		}
+		var found []aur.Package
+		for batch := range slices.Chunk(names, infoBatchSize) {
+			packages, err := aur.Info(batch)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(exitError)
+			}
+			found = append(found, packages...)
+		}
+		for i, r := range results {
+			j := slices.IndexFunc(found, func(p aur.Package) bool { return p.Name == r.Info.Name })
+			if j < 0 {
+				fmt.Printf("No package with matching name '%s' found\n", r.Info.Name)
+				failed++
+				continue
+			}
+			results[i].Differences = compareMetadata(r.Info, found[j])
+		}
+	}
+
+	if machineOutput() {
+		printResults(results)
+	} else {
+		for i, r := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printInspection(r)
+		}
+	}
+
+	switch {
+	case len(results) == 0:
+		os.Exit(exitError)
+	case slices.ContainsFunc(results, func(r inspection) bool { return len(r.Differences) != 0 }):
+		os.Exit(exitProblems)
+	case failed != 0:
+		os.Exit(exitPartial)
+	}
+}
+
+// printInspection displays the details of a package file, its contents if --list is set, and any differences from the AUR.
+func printInspection(r inspection) {
+	f := format.Terminal()
+	label := f.Label
+	date := func(t int64) string {
+		return locale.Time(time.Unix(t, 0))
+	}
+
+	info := r.Info
+	fmt.Print(label("File") + r.File + "\n")
+	fmt.Print(label("Name") + color.Title(info.Name) + "\n")
+	fmt.Print(label("Version") + color.Version(info.Version) + "\n")
+	fmt.Print(label("Description") + f.Text(info.Description))
+	fmt.Print(label("Architecture") + info.Arch + "\n")
+	fmt.Print(label("URL") + format.OrNone(info.URL) + "\n")
+	fmt.Print(label("Licenses") + f.List(info.License))
+	fmt.Print(label("Groups") + f.List(info.Groups))
+	fmt.Print(label("Provides") + f.List(info.Provides))
+	fmt.Print(label("Depends On") + f.List(info.Depends))
+	fmt.Print(label("Optional Deps") + f.Lines(info.OptDepends))
+	fmt.Print(label("Make Deps") + f.List(info.MakeDepends))
+	fmt.Print(label("Check Deps") + f.List(info.CheckDepends))
+	fmt.Print(label("Conflicts With") + f.List(info.Conflicts))
+	fmt.Print(label("Replaces") + f.List(info.Replaces))
+	fmt.Print(label("Backup Files") + f.Lines(info.Backup))
+	fmt.Print(label("Installed Size") + format.Size(info.Size) + "\n")
+	fmt.Print(label("Packager") + format.OrNone(info.Packager) + "\n")
+	fmt.Print(label("Build Date") + date(info.BuildDate) + "\n")
+	fmt.Print(label("Install Script"))
+	if r.Install != "" {
+		fmt.Println("Yes")
+	} else {
+		fmt.Println("No")
+	}
+	if b := r.BuildInfo; b != nil {
+		fmt.Print(label("Build Tool") + strings.TrimSpace(b.BuildTool+" "+b.BuildToolVersion) + "\n")
+		fmt.Print(label("Build Directory") + b.BuildDir + "\n")
+		fmt.Print(label("Build Env") + f.List(b.BuildEnv))
+		fmt.Print(label("Build Options") + f.List(b.Options))
+		fmt.Print(label("PKGBUILD SHA256") + b.PKGBUILDSHA256Sum + "\n")
+		fmt.Print(label("Build Packages") + fmt.Sprint(len(b.Installed)) + "\n")
+	}
+
+	if inspectListFlag {
+		fmt.Println()
+		for _, e := range r.Entries {
+			line := fmt.Sprintf("%s %10s  %s", e.Mode, format.Size(e.Size), e.Path)
+			if e.Link != "" {
+				line += " -> " + e.Link
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if inspectAURFlag {
+		fmt.Println()
+		if len(r.Differences) == 0 {
+			fmt.Println("Metadata matches the AUR")
+		}
+		for _, d := range r.Differences {
+			side := color.Warning("only in package")
+			if d.Only == "aur" {
+				side = color.Error("only on AUR")
+			}
+			fmt.Printf("%s %s %s\n", color.Title(d.Field+":"), d.Value, side)
+		}
+	}
+}
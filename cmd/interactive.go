@@ -0,0 +1,166 @@
+/*
+ * interactive.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+)
+
+/*
+isInteractive reports whether the user can be prompted, which requires stdin and stdout to be terminals.
+*/
+func isInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+/*
+parseSelection parses a selection of numbered items from 1 to n, such as "1-3 5 ^4".
+Numbers and ranges select items; a leading '^' excludes them instead.
+If only exclusions are given, every other item is selected.
+Items are separated by spaces or commas. The selected numbers are returned in ascending order.
+*/
+func parseSelection(input string, n int) (selected []int, err error) {
+	include := make(map[int]bool)
+	exclude := make(map[int]bool)
+	onlyExclusions := true
+
+	for _, token := range strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == ',' }) {
+		target := include
+		if strings.HasPrefix(token, "^") {
+			target, token = exclude, token[1:]
+		} else {
+			onlyExclusions = false
+		}
+
+		first, last, isRange := strings.Cut(token, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection: %s", token)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("invalid selection: %s", token)
+			}
+		}
+		if start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("selection out of range: %s", token)
+		}
+		for i := start; i <= end; i++ {
+			target[i] = true
+		}
+	}
+
+	for i := 1; i <= n; i++ {
+		if (include[i] || (onlyExclusions && len(exclude) != 0)) && !exclude[i] {
+			selected = append(selected, i)
+		}
+	}
+
+	return
+}
+
+/*
+interactiveSearch prompts the user to select packages from results and fetches the selected ones into the current directory.
+*/
+func interactiveSearch(results []aur.Package, installed map[string]string, in io.Reader) error {
+	selected, err := selectResults(results, installed, in, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range selected {
+		fmt.Printf("%s %s\n", color.Group("==> Fetching"), color.Title(p.Name))
+		if err := fetchPackage(p.Name, "."); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+selectResults lists results with numbers on out and prompts the user to select some, reading the answer from in.
+Entering '?' followed by a number displays the details of that result; invalid selections prompt again.
+*/
+func selectResults(results []aur.Package, installed map[string]string, in io.Reader, out io.Writer) (selected []aur.Package, err error) {
+	for i, r := range results {
+		fmt.Fprintf(out, "%s %s\n", color.Warning(strconv.Itoa(i+1)), searchLine(r, installed))
+		fmt.Fprintln(out, "    "+r.Description)
+	}
+
+	reader := bufio.NewReader(in)
+	var numbers []int
+	for {
+		fmt.Fprint(out, color.Group("==> ")+color.Title("Packages to fetch (eg: 1 2 3, 1-3 or ^4; ?N for details of N): "))
+		input, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read selection: %w", err)
+		}
+		input = strings.TrimSpace(input)
+
+		if details, ok := strings.CutPrefix(input, "?"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(details))
+			if err != nil || n < 1 || n > len(results) {
+				fmt.Fprintf(out, "No result numbered '%s'\n", details)
+			} else {
+				fmt.Fprint(out, results[n-1].Formatted())
+			}
+			continue
+		}
+		if numbers, err = parseSelection(input, len(results)); err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		break
+	}
+
+	for _, i := range numbers {
+		selected = append(selected, results[i-1])
+	}
+
+	return
+}
+
+/*
+confirm asks the user a yes or no question on out, reading the answer from in.
+An empty answer accepts, as in pacman; no answer at all, such as at the end of input, declines.
+*/
+func confirm(out io.Writer, question string, in io.Reader) bool {
+	fmt.Fprint(out, color.Group("==> ")+color.Title(question+" [Y/n] "))
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "" || answer == "y" || answer == "yes"
+}
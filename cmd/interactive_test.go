@@ -0,0 +1,138 @@
+/*
+ * interactive_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bmoller/pkg/aur"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"2", []int{2}, false},
+		{"1 3 5", []int{1, 3, 5}, false},
+		{"5,1,3", []int{1, 3, 5}, false},
+		{"3 3", []int{3}, false},
+		{"1-3", []int{1, 2, 3}, false},
+		{"1-3 5", []int{1, 2, 3, 5}, false},
+		{"^4", []int{1, 2, 3, 5}, false},
+		{"^1-3", []int{4, 5}, false},
+		{"^1 ^5", []int{2, 3, 4}, false},
+		{"1-4 ^2", []int{1, 3, 4}, false},
+		{"^2 1-4", []int{1, 3, 4}, false},
+		{"0", nil, true},
+		{"6", nil, true},
+		{"4-6", nil, true},
+		{"3-1", nil, true},
+		{"a", nil, true},
+		{"1-b", nil, true},
+		{"^", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSelection(tt.input, 5)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSelection(%q) error = %v, want error: %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseSelection(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectResults(t *testing.T) {
+	results := []aur.Package{
+		{Name: "foo", Version: "1.0-1", Description: "The foo tool"},
+		{Name: "bar", Version: "2.0-1", Description: "The bar library", Maintainer: "someone", URL: "https://bar.example.org"},
+		{Name: "baz", Version: "3.0-1", Description: "The baz plugin"},
+	}
+	names := func(packages []aur.Package) (n []string) {
+		for _, p := range packages {
+			n = append(n, p.Name)
+		}
+		return
+	}
+
+	// details requests and invalid selections prompt again before the selection is read
+	var out strings.Builder
+	selected, err := selectResults(results, map[string]string{"foo": "1.0-1"}, strings.NewReader("?2\n?9\n?x\n1-9\n^2\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(selected); !slices.Equal(got, []string{"foo", "baz"}) {
+		t.Errorf("selected %q, want [foo baz]", got)
+	}
+	printed := out.String()
+	for _, want := range []string{
+		"1 aur/foo 1.0-1 [installed]\n    The foo tool\n",
+		"2 aur/bar 2.0-1\n    The bar library\n",
+		"3 aur/baz 3.0-1\n    The baz plugin\n",
+		results[1].Formatted(),
+		"No result numbered '9'\n",
+		"No result numbered 'x'\n",
+		"selection out of range: 1-9\n",
+	} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("output does not contain %q:\n%s", want, printed)
+		}
+	}
+	if n := strings.Count(printed, "Packages to fetch"); n != 5 {
+		t.Errorf("prompted %d times, want 5", n)
+	}
+	if strings.Contains(printed, "The foo tool\nRepository") || strings.Count(printed, "Name            :") != 1 {
+		t.Errorf("details printed for results that were not requested:\n%s", printed)
+	}
+
+	// an empty selection, or the end of input, selects nothing
+	for _, input := range []string{"\n", ""} {
+		selected, err := selectResults(results, nil, strings.NewReader(input), io.Discard)
+		if err != nil || len(selected) != 0 {
+			t.Errorf("selectResults(%q) = %q, %v; want nothing selected", input, names(selected), err)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"\n", true},
+		{"y\n", true},
+		{"Yes\n", true},
+		{"n\n", false},
+		{"no\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := confirm(io.Discard, "Proceed?", strings.NewReader(tt.answer)); got != tt.want {
+			t.Errorf("confirm(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+/*
+ * keys.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/archive"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/pgp"
+	"github.com/bmoller/pkg/sources"
+	"github.com/bmoller/pkg/srcinfo"
+	"github.com/bmoller/pkg/vcs"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys package...",
+	Short: "Check the PGP keys needed to verify the sources of AUR packages",
+	Long: `The keys command collects the PGP keys listed in the validpgpkeys of each
+package, and of the AUR packages that would be built to satisfy its
+dependencies, and reports which are missing from the GnuPG keyring; makepkg
+cannot verify signed sources without them. The .SRCINFO is read from the AUR,
+or from the directory if an argument names a directory containing one;
+dependencies are only resolved for packages from the AUR.
+
+With --verify the detached signatures among the sources of the host
+architecture, files ending in .sig, .asc or .sign, are downloaded with the files
+they sign and checked as makepkg does: the signature must be good and made by
+one of the package's validpgpkeys. A signature of a file that is not a source
+is checked against the decompressed contents of a gzip, xz or zstd compressed
+source of the same name. Downloads share the cache of the sources command.
+
+Missing keys are imported from a keyring or exported key file with --keyring,
+or from a keyserver with --keyserver, such as hkps://keys.openpgp.org. Only
+the missing keys are imported, once confirmed; without a terminal to confirm
+on, keys are only imported with --noconfirm.
+
+The exit status is 4 if any key is missing or any signature fails verification.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  keysCheck,
+}
+
+var keysVerifyFlag = false
+var keysKeyringFlag = ""
+var keysKeyserverFlag = ""
+var keysNoConfirmFlag = false
+var keysJobsFlag = 4
+var keysCacheDirFlag = ""
+
+func init() {
+	flags := keysCmd.PersistentFlags()
+	flags.BoolVarP(&keysVerifyFlag, "verify", "V", false, "Verify the detached signatures of sources")
+	flags.StringVar(&keysKeyringFlag, "keyring", "", "Keyring or exported key file to import missing keys from")
+	flags.StringVar(&keysKeyserverFlag, "keyserver", "", "Keyserver URL to import missing keys from")
+	flags.BoolVar(&keysNoConfirmFlag, "noconfirm", false, "Import keys without asking for confirmation")
+	flags.IntVarP(&keysJobsFlag, "jobs", "j", 4, "Number of sources to download at a time")
+	flags.StringVar(&keysCacheDirFlag, "cache-dir", "", "Directory to cache downloads in (default $XDG_CACHE_HOME/pkg/sources)")
+	keysCmd.MarkFlagsMutuallyExclusive("keyring", "keyserver")
+}
+
+/*
+A keyState records whether a key listed in validpgpkeys is in the keyring.
+*/
+type keyState struct {
+	Fingerprint string
+	UserID      string // first user ID of the key, if present
+	Present     bool
+}
+
+// statuses of a signatureCheck besides those of pgp.Status
+const (
+	signatureUntrusted = "untrusted" // good, but made by a key not in validpgpkeys
+	signatureError     = "error"     // the signature or signed file could not be retrieved
+)
+
+/*
+A signatureCheck is the outcome of verifying a detached signature among a package's sources.
+*/
+type signatureCheck struct {
+	Signature string // name of the signature file
+	File      string // name of the signed source
+	Status    string // a pgp.Status, signatureUntrusted, or signatureError
+	Key       string // fingerprint of the signing key, or its key ID if the key is missing
+	Error     string
+}
+
+/*
+A keyReport holds the keys and signature checks of a package.
+*/
+type keyReport struct {
+	Package    string
+	Keys       []keyState
+	Signatures []signatureCheck
+}
+
+/*
+keyPackages returns the packages whose keys are checked: the local directories in args as given,
+and the packages from the AUR along with one package of each AUR base needed for their dependencies.
+*/
+func keyPackages(args []string) (names []string, err error) {
+	var remote []string
+	for _, name := range args {
+		if _, err := os.Stat(filepath.Join(name, ".SRCINFO")); err == nil {
+			names = append(names, name)
+		} else {
+			remote = append(remote, name)
+		}
+	}
+	if len(remote) == 0 {
+		return
+	}
+
+	order, err := resolveBuild(remote, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range order {
+		names = append(names, t.Names[0])
+	}
+
+	return
+}
+
+/*
+updateKeys looks up the keys of every report in the keyring, setting whether each is present.
+The fingerprints of the missing keys are returned without duplicates.
+*/
+func updateKeys(reports []keyReport) (missing []string, err error) {
+	var wanted []string
+	for _, r := range reports {
+		for _, k := range r.Keys {
+			wanted = append(wanted, k.Fingerprint)
+		}
+	}
+	slices.Sort(wanted)
+	local, err := pgp.LocalKeys(slices.Compact(wanted))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range reports {
+		for i, k := range r.Keys {
+			j := slices.IndexFunc(local, func(l pgp.Key) bool { return l.Has(k.Fingerprint) })
+			r.Keys[i].Present = j >= 0
+			if j < 0 {
+				if !slices.Contains(missing, k.Fingerprint) {
+					missing = append(missing, k.Fingerprint)
+				}
+			} else if len(local[j].UserIDs) != 0 {
+				r.Keys[i].UserID = local[j].UserIDs[0]
+			}
+		}
+	}
+
+	return
+}
+
+/*
+importKeys lists the missing keys with the packages needing them and imports them
+from the keyring file or keyserver given, once confirmed.
+imported is false if the user declined or could not be asked.
+*/
+func importKeys(missing []string, reports []keyReport) (imported bool, err error) {
+	from := cmp.Or(keysKeyringFlag, keysKeyserverFlag)
+	out := buildOutput()
+	fmt.Fprintf(out, "%s %d keys missing from the keyring\n", color.Group("==>"), len(missing))
+	for _, k := range missing {
+		var needed []string
+		for _, r := range reports {
+			if slices.ContainsFunc(r.Keys, func(s keyState) bool { return s.Fingerprint == k }) {
+				needed = append(needed, r.Package)
+			}
+		}
+		fmt.Fprintf(out, "  %s %s\n", k, color.Meta("(needed by "+strings.Join(needed, ", ")+")"))
+	}
+
+	if !keysNoConfirmFlag {
+		if !isInteractive() {
+			fmt.Fprintln(out, "Not importing keys: confirmation requires a terminal; use --noconfirm to import anyway")
+			return false, nil
+		}
+		if !confirm(out, fmt.Sprintf("Import %d keys from %s?", len(missing), from), os.Stdin) {
+			return false, nil
+		}
+	}
+
+	if keysKeyringFlag != "" {
+		err = pgp.ImportFile(keysKeyringFlag, missing)
+	} else {
+		err = pgp.Receive(keysKeyserverFlag, missing)
+	}
+
+	return true, err
+}
+
+// suffixes of detached signature files, as makepkg recognizes them
+var signatureSuffixes = []string{".sig", ".asc", ".sign"}
+
+// suffixes of compressed sources whose decompressed contents a signature may cover, in the formats archive.Decompress reads
+var compressedSuffixes = []string{".gz", ".xz", ".zst"}
+
+// isSignature reports whether the source file named name is a detached signature.
+func isSignature(name string) bool {
+	return slices.ContainsFunc(signatureSuffixes, func(suffix string) bool { return strings.HasSuffix(name, suffix) })
+}
+
+/*
+signedSource returns the source among srcs that the signature file named name signs.
+compressed is set if the signature covers the decompressed contents of the source.
+ok is false if no source matches the signature.
+*/
+func signedSource(srcs []srcinfo.Source, name string) (s srcinfo.Source, compressed, ok bool) {
+	signed := name
+	for _, suffix := range signatureSuffixes {
+		signed = strings.TrimSuffix(signed, suffix)
+	}
+	candidates := []string{signed}
+	for _, suffix := range compressedSuffixes {
+		candidates = append(candidates, signed+suffix)
+	}
+
+	for _, candidate := range candidates {
+		i := slices.IndexFunc(srcs, func(s srcinfo.Source) bool { return vcs.ParseSource(s.Entry).Name == candidate })
+		if i >= 0 {
+			return srcs[i], candidate != signed, true
+		}
+	}
+
+	return srcinfo.Source{}, false, false
+}
+
+/*
+openSource opens a retrieved source: the downloaded file, or the file bundled with the package read using open.
+*/
+func openSource(r sources.Result, open func(name string) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if r.Path != "" {
+		return os.Open(r.Path)
+	}
+
+	return open(vcs.ParseSource(r.Entry).URL)
+}
+
+/*
+checkSignature verifies the retrieved signature sig of the retrieved source data against the package's keys.
+*/
+func checkSignature(sig, data sources.Result, compressed bool, p sourcePackage) (check signatureCheck) {
+	check = signatureCheck{Signature: sig.Name, File: data.Name}
+	for _, r := range []sources.Result{sig, data} {
+		if r.Status == sources.Failed || r.Status == sources.Mismatch {
+			check.Status, check.Error = signatureError, r.Name+": "+cmp.Or(r.Error, "checksum mismatch")
+			return
+		}
+	}
+	fail := func(err error) signatureCheck {
+		check.Status, check.Error = signatureError, err.Error()
+		return check
+	}
+
+	// gpg reads the signature from a file, so one bundled with the package is copied out first
+	path := sig.Path
+	if path == "" {
+		r, err := openSource(sig, p.open)
+		if err != nil {
+			return fail(err)
+		}
+		tmp, err := os.CreateTemp("", "pkg-signature-")
+		if err == nil {
+			defer os.Remove(tmp.Name())
+			_, err = io.Copy(tmp, r)
+			tmp.Close()
+		}
+		r.Close()
+		if err != nil {
+			return fail(fmt.Errorf("failed to copy signature: %w", err))
+		}
+		path = tmp.Name()
+	}
+
+	r, err := openSource(data, p.open)
+	if err != nil {
+		return fail(err)
+	}
+	defer r.Close()
+	if compressed {
+		if r, err = archive.Decompress(r); err != nil {
+			return fail(err)
+		}
+		defer r.Close()
+	}
+
+	v, err := pgp.Verify(path, r)
+	if err != nil {
+		return fail(err)
+	}
+	check.Status, check.Key = string(v.Status), cmp.Or(v.Primary, v.Fingerprint)
+	if v.Status == pgp.Good && !v.SignedBy(p.info.Base.Values["validpgpkeys"]) {
+		check.Status = signatureUntrusted
+	}
+
+	return
+}
+
+/*
+verifySignatures downloads the signatures among the sources of each package with the files they sign,
+and records the outcome of verifying each in the package's report.
+*/
+func verifySignatures(cache *sources.Cache, packages []sourcePackage, reports []keyReport) {
+	type pending struct {
+		report, check     int // indexes of the report and its signature check
+		signature, signed int // indexes of the requests for the signature and the signed source
+		compressed        bool
+	}
+	var requests []sources.Request
+	var checks []pending
+	for i, p := range packages {
+		for _, s := range p.sources {
+			source := vcs.ParseSource(s.Entry)
+			if source.VCS != "" || !isSignature(source.Name) {
+				continue
+			}
+			check := signatureCheck{Signature: source.Name}
+			signed, compressed, ok := signedSource(p.sources, source.Name)
+			if !ok {
+				check.Status, check.Error = signatureError, "no source matches the signature"
+			} else {
+				checks = append(checks, pending{i, len(reports[i].Signatures), len(requests), len(requests) + 1, compressed})
+				requests = append(requests, sources.Request{Source: s, Open: p.open}, sources.Request{Source: signed, Open: p.open})
+			}
+			reports[i].Signatures = append(reports[i].Signatures, check)
+		}
+	}
+
+	results := cache.GetAll(requests, keysJobsFlag)
+	for _, c := range checks {
+		reports[c.report].Signatures[c.check] = checkSignature(results[c.signature], results[c.signed], c.compressed, packages[c.report])
+	}
+}
+
+func keysCheck(cmd *cobra.Command, args []string) {
+	names, err := keyPackages(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	packages, failed := loadSourcePackages(names)
+	if len(packages) == 0 {
+		os.Exit(exitError)
+	}
+
+	reports := make([]keyReport, len(packages))
+	for i, p := range packages {
+		reports[i].Package = p.name
+		for _, k := range p.info.Base.Values["validpgpkeys"] {
+			reports[i].Keys = append(reports[i].Keys, keyState{Fingerprint: pgp.NormalizeFingerprint(k)})
+		}
+	}
+	missing, err := updateKeys(reports)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	if len(missing) != 0 && (keysKeyringFlag != "" || keysKeyserverFlag != "") {
+		imported, err := importKeys(missing, reports)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if imported {
+			if _, err = updateKeys(reports); err != nil {
+				fmt.Println(err)
+				os.Exit(exitError)
+			}
+		}
+	}
+
+	if keysVerifyFlag {
+		cache, err := sourceCache(keysCacheDirFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		verifySignatures(cache, packages, reports)
+	}
+
+	problems := false
+	for _, r := range reports {
+		problems = problems || slices.ContainsFunc(r.Keys, func(k keyState) bool { return !k.Present }) ||
+			slices.ContainsFunc(r.Signatures, func(s signatureCheck) bool { return s.Status != string(pgp.Good) })
+		if !machineOutput() {
+			printKeyReport(r)
+		}
+	}
+	if machineOutput() {
+		printResults(reports)
+	}
+
+	switch {
+	case problems:
+		os.Exit(exitProblems)
+	case failed != 0:
+		os.Exit(exitPartial)
+	}
+}
+
+// printKeyReport displays the keys and signature checks of a package.
+func printKeyReport(r keyReport) {
+	fmt.Printf("%s %s\n", color.Group("==>"), color.Title(r.Package))
+	if len(r.Keys) == 0 {
+		fmt.Println("  No validpgpkeys")
+	}
+	for _, k := range r.Keys {
+		if k.Present {
+			fmt.Printf("  %s %s %s\n", color.Version("present  "), k.Fingerprint, k.UserID)
+		} else {
+			fmt.Printf("  %s %s\n", color.Error("missing  "), k.Fingerprint)
+		}
+	}
+
+	for _, s := range r.Signatures {
+		status := fmt.Sprintf("%-9s", s.Status)
+		if s.Status == string(pgp.Good) {
+			status = color.Version(status)
+		} else {
+			status = color.Error(status)
+		}
+		line := "  " + status + " " + s.Signature
+		if s.File != "" {
+			line += " " + color.Meta("for "+s.File)
+		}
+		switch {
+		case s.Error != "":
+			line += ": " + s.Error
+		case s.Key != "":
+			line += ", signed by " + s.Key
+		}
+		fmt.Println(line)
+	}
+}
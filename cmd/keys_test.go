@@ -0,0 +1,73 @@
+/*
+ * keys_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"testing"
+
+	"github.com/bmoller/pkg/srcinfo"
+)
+
+func TestIsSignature(t *testing.T) {
+	tests := map[string]bool{
+		"foo-1.0.tar.gz.sig":  true,
+		"foo-1.0.tar.gz.asc":  true,
+		"foo-1.0.tar.xz.sign": true,
+		"foo-1.0.tar.gz":      false,
+		"signature.txt":       false,
+		"foo.sig.tar.gz":      false,
+		"keys/KEYS":           false,
+	}
+	for name, want := range tests {
+		if got := isSignature(name); got != want {
+			t.Errorf("isSignature(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSignedSource(t *testing.T) {
+	srcs := []srcinfo.Source{
+		{Entry: "https://example.org/foo-1.0.tar.gz"},
+		{Entry: "https://example.org/foo-1.0.tar.gz.sig"},
+		{Entry: "renamed.tar::https://example.org/download?id=1"},
+		{Entry: "renamed.tar.asc::https://example.org/download?id=1&sig"},
+		{Entry: "https://example.org/bar-2.0.tar.xz"},
+		{Entry: "https://example.org/bar-2.0.tar.sign"},
+		{Entry: "baz.patch"},
+	}
+	tests := []struct {
+		name       string
+		entry      string
+		compressed bool
+		ok         bool
+	}{
+		{"foo-1.0.tar.gz.sig", "https://example.org/foo-1.0.tar.gz", false, true},
+		{"renamed.tar.asc", "renamed.tar::https://example.org/download?id=1", false, true},
+		// the signature covers the decompressed tarball
+		{"bar-2.0.tar.sign", "https://example.org/bar-2.0.tar.xz", true, true},
+		{"baz.patch.sig", "baz.patch", false, true},
+		{"missing.tar.gz.sig", "", false, false},
+	}
+	for _, tt := range tests {
+		s, compressed, ok := signedSource(srcs, tt.name)
+		if s.Entry != tt.entry || compressed != tt.compressed || ok != tt.ok {
+			t.Errorf("signedSource(%q) = %q, %v, %v; want %q, %v, %v", tt.name, s.Entry, compressed, ok, tt.entry, tt.compressed, tt.ok)
+		}
+	}
+}
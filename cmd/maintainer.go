@@ -0,0 +1,306 @@
+/*
+ * maintainer.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/locale"
+)
+
+var maintainerCmd = &cobra.Command{
+	Use:   "maintainer user",
+	Short: "Show a dashboard of the AUR packages a user maintains",
+	Long: `The maintainer command lists every AUR package the user maintains or
+co-maintains with its version, votes, popularity, last modification date and
+out-of-date flag, the AUR packages depending on it, and, for packages with a
+source configured for the upstream command, the latest upstream version.
+
+Packages are sorted by name unless --sort selects votes, popularity, modified,
+out-of-date, dependents or upstream. out-of-date lists the packages flagged
+longest ago first and unflagged packages last; upstream lists packages with a
+newer upstream version first. --output exports the dashboard, for example as
+tsv for a spreadsheet.
+
+Finding dependents takes four AUR searches per package; --no-dependents skips
+them for users with many packages.`,
+	Args: cobra.ExactArgs(1),
+	Run:  maintainerDashboard,
+}
+
+var maintainerSortFlag = "name"
+var maintainerReverseFlag = false
+var maintainerNoDependentsFlag = false
+var maintainerJobsFlag = 4
+
+func init() {
+	flags := maintainerCmd.PersistentFlags()
+	flags.StringVarP(&maintainerSortFlag, "sort", "s", "name", "Sort by name, votes, popularity, modified, out-of-date, dependents, or upstream")
+	flags.BoolVarP(&maintainerReverseFlag, "reverse", "r", false, "Sort in descending order")
+	flags.BoolVar(&maintainerNoDependentsFlag, "no-dependents", false, "Skip looking up packages depending on each package")
+	flags.IntVarP(&maintainerJobsFlag, "jobs", "j", 4, "Number of packages to look up at a time")
+}
+
+// roles of a user in a package
+const (
+	roleMaintainer   = "maintainer"
+	roleCoMaintainer = "co-maintainer"
+)
+
+/*
+A maintainedPackage is a row of the maintainer dashboard.
+*/
+type maintainedPackage struct {
+	Name           string
+	PackageBase    string
+	Role           string // maintainer or co-maintainer
+	Version        string
+	NumVotes       int
+	Popularity     json.Number
+	LastModified   int      // Unix timestamp
+	OutOfDate      int      // Unix timestamp of the out-of-date flag, if any
+	Dependents     []string // AUR packages depending on the package
+	Upstream       string   // latest upstream version, if a source is configured
+	UpstreamStatus string   // as listed by the upstream command, if a source is configured
+	UpstreamError  string
+}
+
+// order of upstream statuses when sorting, most in need of attention first
+var upstreamRanks = []string{upstreamOutdated, upstreamAhead, upstreamError, upstreamCurrent, ""}
+
+// comparison functions for each supported sort order
+var maintainerSorts = map[string]func(a, b maintainedPackage) int{
+	"name":  func(a, b maintainedPackage) int { return cmp.Compare(a.Name, b.Name) },
+	"votes": func(a, b maintainedPackage) int { return cmp.Compare(a.NumVotes, b.NumVotes) },
+	"popularity": func(a, b maintainedPackage) int {
+		pa, _ := a.Popularity.Float64()
+		pb, _ := b.Popularity.Float64()
+		return cmp.Compare(pa, pb)
+	},
+	"modified": func(a, b maintainedPackage) int { return cmp.Compare(a.LastModified, b.LastModified) },
+	"out-of-date": func(a, b maintainedPackage) int {
+		// unflagged packages sort after every flagged one
+		flagged := func(p maintainedPackage) int { return cmp.Or(p.OutOfDate, math.MaxInt) }
+		return cmp.Compare(flagged(a), flagged(b))
+	},
+	"dependents": func(a, b maintainedPackage) int { return cmp.Compare(len(a.Dependents), len(b.Dependents)) },
+	"upstream": func(a, b maintainedPackage) int {
+		return cmp.Compare(slices.Index(upstreamRanks, a.UpstreamStatus), slices.Index(upstreamRanks, b.UpstreamStatus))
+	},
+}
+
+/*
+maintainedPackages returns the packages user maintains followed by those the user co-maintains.
+*/
+func maintainedPackages(user string) (packages []maintainedPackage, found []aur.Package, err error) {
+	for _, role := range []struct {
+		name string
+		by   aur.SearchType
+	}{{roleMaintainer, aur.Maintainer}, {roleCoMaintainer, aur.CoMaintainers}} {
+		results, err := aurAPI.Search(user, role.by)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range results {
+			if slices.ContainsFunc(found, func(f aur.Package) bool { return f.Name == p.Name }) {
+				continue
+			}
+			found = append(found, p)
+			packages = append(packages, maintainedPackage{
+				Name:         p.Name,
+				PackageBase:  p.PackageBase,
+				Role:         role.name,
+				Version:      p.Version,
+				NumVotes:     p.NumVotes,
+				Popularity:   p.Popularity,
+				LastModified: p.LastModified,
+				OutOfDate:    p.OutOfDate,
+			})
+		}
+	}
+
+	return
+}
+
+/*
+findDependents sets the AUR packages depending on each package, searching up to jobs packages at a time.
+The number of packages whose dependents could not all be found is returned.
+*/
+func findDependents(packages []maintainedPackage, jobs int) (failed int) {
+	var mu sync.Mutex
+	limit := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i := range packages {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+			p := &packages[i]
+			for _, t := range []aur.SearchType{aur.Depends, aur.MakeDepends, aur.OptDepends, aur.CheckDepends} {
+				found, err := aurAPI.Search(p.Name, t)
+				if err != nil {
+					mu.Lock()
+					fmt.Printf("%s: %s\n", p.Name, err)
+					failed++
+					mu.Unlock()
+					return
+				}
+				for _, d := range found {
+					if d.Name != p.Name && !slices.Contains(p.Dependents, d.Name) {
+						p.Dependents = append(p.Dependents, d.Name)
+					}
+				}
+			}
+			slices.Sort(p.Dependents)
+		}()
+	}
+	wg.Wait()
+
+	return
+}
+
+/*
+sortMaintained sorts packages using compare, breaking ties by name, in descending order if reverse is set.
+*/
+func sortMaintained(packages []maintainedPackage, compare func(a, b maintainedPackage) int, reverse bool) {
+	slices.SortStableFunc(packages, func(a, b maintainedPackage) int {
+		c := cmp.Or(compare(a, b), cmp.Compare(a.Name, b.Name))
+		if reverse {
+			return -c
+		}
+		return c
+	})
+}
+
+func maintainerDashboard(cmd *cobra.Command, args []string) {
+	user := args[0]
+	compare, ok := maintainerSorts[maintainerSortFlag]
+	if !ok {
+		fmt.Printf("unrecognized sort order: %s\n", maintainerSortFlag)
+		os.Exit(exitError)
+	}
+	config, err := loadUpstreamConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	packages, found, err := maintainedPackages(user)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if len(packages) == 0 {
+		fmt.Printf("No packages maintained by '%s' found\n", user)
+		os.Exit(exitNotFound)
+	}
+
+	failed := 0
+	if !maintainerNoDependentsFlag {
+		failed = findDependents(packages, maintainerJobsFlag)
+	}
+	for _, r := range checkUpstream(config, found, maintainerJobsFlag) {
+		i := slices.IndexFunc(packages, func(p maintainedPackage) bool { return p.Name == r.Name })
+		packages[i].Upstream, packages[i].UpstreamStatus, packages[i].UpstreamError = r.Upstream, r.Status, r.Error
+		if r.Status == upstreamError {
+			failed++
+		}
+	}
+
+	sortMaintained(packages, compare, maintainerReverseFlag)
+
+	if machineOutput() {
+		printResults(packages)
+	} else {
+		printDashboard(user, packages)
+	}
+
+	if failed != 0 {
+		os.Exit(exitPartial)
+	}
+}
+
+// dashboardDate formats a Unix timestamp as a date in the user's locale for the dashboard.
+func dashboardDate(t int) string {
+	return locale.Date(time.Unix(int64(t), 0))
+}
+
+/*
+printDashboard displays a summary of the user's packages followed by the details of each.
+*/
+func printDashboard(user string, packages []maintainedPackage) {
+	outOfDate, outdated := 0, 0
+	for _, p := range packages {
+		if p.OutOfDate != 0 {
+			outOfDate++
+		}
+		if p.UpstreamStatus == upstreamOutdated {
+			outdated++
+		}
+	}
+	fmt.Printf("%s %d packages maintained by %s: %d flagged out-of-date, %d with newer upstream versions\n",
+		color.Group("==>"), len(packages), color.Title(user), outOfDate, outdated)
+
+	for _, p := range packages {
+		popularity, _ := p.Popularity.Float64()
+		line := color.Repo("aur/") + color.Title(p.Name) + " " + color.Version(p.Version) +
+			" " + color.Meta(fmt.Sprintf("(+%d %.2f)", p.NumVotes, popularity))
+		if p.OutOfDate != 0 {
+			line += " " + color.Error("(Out-of-date since "+dashboardDate(p.OutOfDate)+")")
+		}
+		if p.Role == roleCoMaintainer {
+			line += " " + color.Meta("[co-maintainer]")
+		}
+		fmt.Println(line)
+
+		details := "Last modified " + dashboardDate(p.LastModified)
+		if !maintainerNoDependentsFlag {
+			details += fmt.Sprintf(", %d dependents", len(p.Dependents))
+			if len(p.Dependents) != 0 {
+				details += ": " + strings.Join(p.Dependents, " ")
+			}
+		}
+		fmt.Println("    " + details)
+
+		switch p.UpstreamStatus {
+		case upstreamOutdated:
+			fmt.Printf("    Upstream %s available\n", color.Version(p.Upstream))
+		case upstreamAhead:
+			fmt.Printf("    Upstream %s\n", color.Warning(p.Upstream+" is older than the AUR's version"))
+		case upstreamError:
+			fmt.Printf("    Upstream %s\n", color.Error(p.UpstreamError))
+		case upstreamCurrent:
+			fmt.Println("    Upstream up to date")
+		}
+	}
+}
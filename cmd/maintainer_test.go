@@ -0,0 +1,109 @@
+/*
+ * maintainer_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/bmoller/pkg/aur"
+)
+
+func TestMaintainerSorts(t *testing.T) {
+	packages := []maintainedPackage{
+		{Name: "alpha", NumVotes: 5, Popularity: json.Number("0.5"), LastModified: 300, OutOfDate: 0, UpstreamStatus: upstreamCurrent},
+		{Name: "bravo", NumVotes: 10, Popularity: json.Number("0.1"), LastModified: 100, OutOfDate: 200, UpstreamStatus: upstreamOutdated},
+		{Name: "charlie", NumVotes: 5, Popularity: json.Number("2.25"), LastModified: 200, OutOfDate: 100, UpstreamStatus: ""},
+		{Name: "delta", NumVotes: 1, Popularity: json.Number("0"), LastModified: 400, OutOfDate: 0, Dependents: []string{"x", "y"}, UpstreamStatus: upstreamError},
+		{Name: "echo", NumVotes: 0, Popularity: json.Number("0"), LastModified: 50, OutOfDate: 0, Dependents: []string{"z"}, UpstreamStatus: upstreamAhead},
+	}
+	tests := []struct {
+		sort    string
+		reverse bool
+		want    []string
+	}{
+		{"name", false, []string{"alpha", "bravo", "charlie", "delta", "echo"}},
+		{"name", true, []string{"echo", "delta", "charlie", "bravo", "alpha"}},
+		{"votes", false, []string{"echo", "delta", "alpha", "charlie", "bravo"}},
+		{"votes", true, []string{"bravo", "charlie", "alpha", "delta", "echo"}},
+		{"popularity", false, []string{"delta", "echo", "bravo", "alpha", "charlie"}},
+		{"modified", false, []string{"echo", "bravo", "charlie", "alpha", "delta"}},
+		// flagged packages come first, longest flagged first, and unflagged ones last
+		{"out-of-date", false, []string{"charlie", "bravo", "alpha", "delta", "echo"}},
+		{"out-of-date", true, []string{"echo", "delta", "alpha", "bravo", "charlie"}},
+		{"dependents", false, []string{"alpha", "bravo", "charlie", "echo", "delta"}},
+		// outdated, ahead, error, current, then packages without a source
+		{"upstream", false, []string{"bravo", "echo", "delta", "alpha", "charlie"}},
+		{"upstream", true, []string{"charlie", "alpha", "delta", "echo", "bravo"}},
+	}
+	for _, tt := range tests {
+		sorted := slices.Clone(packages)
+		sortMaintained(sorted, maintainerSorts[tt.sort], tt.reverse)
+		var names []string
+		for _, p := range sorted {
+			names = append(names, p.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("sort %s (reverse %v) = %q, want %q", tt.sort, tt.reverse, names, tt.want)
+		}
+	}
+}
+
+func TestFindDependents(t *testing.T) {
+	// dependents of each package by search type; a package may appear under several types and as its own dependent
+	dependents := map[string]map[aur.SearchType][]string{
+		"libfoo": {
+			aur.Depends:      {"app", "tool"},
+			aur.MakeDepends:  {"app", "libfoo"},
+			aur.OptDepends:   {"extra"},
+			aur.CheckDepends: {"tool"},
+		},
+		"libbar": {},
+		"broken": {aur.Depends: {"app"}},
+	}
+	saved := aurAPI
+	defer func() { aurAPI = saved }()
+	aurAPI = aurLookup{
+		Search: func(keyword string, by aur.SearchType) (found []aur.Package, err error) {
+			if keyword == "broken" && by == aur.MakeDepends {
+				return nil, errors.New("search failed")
+			}
+			for _, name := range dependents[keyword][by] {
+				found = append(found, aur.Package{Name: name})
+			}
+			return
+		},
+	}
+
+	packages := []maintainedPackage{{Name: "libfoo"}, {Name: "libbar"}, {Name: "broken"}}
+	if failed := findDependents(packages, 2); failed != 1 {
+		t.Errorf("findDependents failed = %d, want 1", failed)
+	}
+	want := map[string][]string{
+		"libfoo": {"app", "extra", "tool"},
+		"libbar": nil,
+	}
+	for _, p := range packages[:2] {
+		if !slices.Equal(p.Dependents, want[p.Name]) {
+			t.Errorf("%s dependents = %q, want %q", p.Name, p.Dependents, want[p.Name])
+		}
+	}
+}
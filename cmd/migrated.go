@@ -0,0 +1,77 @@
+/*
+ * migrated.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
+)
+
+var migratedCmd = &cobra.Command{
+	Use:   "migrated",
+	Short: "List locally-built packages now available from a sync repository",
+	Long: `The migrated command finds installed packages that were built locally, usually
+from the AUR, but are now available from a configured sync repository. A
+package is flagged when a repository package has the same name but no PGP
+signature was validated when the installed package was installed, as repository
+packages are signed and local builds are not. A foreign package is also flagged
+when a repository package's name appears in its provides or replaces, or the
+repository package replaces it. The installed and repository versions are
+displayed so the official build can be installed instead.
+
+With SigLevel set to Never in pacman.conf no installed package is validated, so
+every package available from a sync repository is flagged.`,
+	Args: cobra.NoArgs,
+	Run:  migrated,
+}
+
+func migrated(cmd *cobra.Command, args []string) {
+	syncRepos, err := libalpm.GetConfigRepos(libalpm.DefaultConfig)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	syncRepos = libalpm.CheckSyncDBs(syncRepos, libalpm.DefaultDBPath)
+	localPkgs, err := libalpm.GetLocalPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	syncPkgs, err := libalpm.GetSyncPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath, syncRepos)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	migrations := libalpm.FindMigrated(localPkgs, syncPkgs)
+	if machineOutput() {
+		printResults(migrations)
+		return
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s %s -> %s%s %s (%s)\n", color.Title(m.Installed.Name), color.Version(m.Installed.Version),
+			color.Repo(m.Available.Repo+"/"), color.Title(m.Available.Name), color.Version(m.Available.Version), m.Match)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * orphans.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/format"
+	"github.com/bmoller/pkg/libalpm"
+)
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "List packages installed as dependencies that are no longer required",
+	Long: `The orphans command lists locally-installed packages that were installed as a
+dependency of another package but are no longer required by any installed
+package. This command is similar to 'pacman -Qdt'. Optional dependencies can be
+counted as requirements, and orphans can be found recursively to include
+packages only required by other orphans.`,
+	Args: cobra.NoArgs,
+	Run:  orphans,
+}
+
+var orphansOptionalFlag = false
+var orphansRecursiveFlag = false
+
+func init() {
+	orphansCmd.PersistentFlags().BoolVarP(&orphansOptionalFlag, "optional", "o", false, "Treat optional dependencies as requirements")
+	orphansCmd.PersistentFlags().BoolVarP(&orphansRecursiveFlag, "recursive", "r", false, "Include packages only required by other orphans")
+}
+
+func orphans(cmd *cobra.Command, args []string) {
+	pkgs, err := libalpm.GetLocalPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	names := libalpm.FindOrphans(pkgs, orphansOptionalFlag, orphansRecursiveFlag)
+	if machineOutput() {
+		var results []libalpm.Package
+		for _, name := range names {
+			results = append(results, pkgs[name])
+		}
+		printResults(results)
+		return
+	}
+	var total int64
+	for _, name := range names {
+		fmt.Printf("%s %s (%s)\n", color.Title(name), color.Version(pkgs[name].Version), format.Size(pkgs[name].InstalledSize))
+		total += pkgs[name].InstalledSize
+	}
+	if len(names) != 0 {
+		fmt.Printf("%d orphaned packages using %s.\n", len(names), format.Size(total))
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ * output.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// machine-readable output formats
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatYAML   = "yaml"
+	formatTSV    = "tsv"
+)
+
+var outputFlag = ""
+
+func init() {
+	rootCommand.PersistentFlags().StringVar(&outputFlag, "output", "", "Output format: json, ndjson, yaml, tsv, or a Go template")
+}
+
+/*
+machineOutput reports whether a machine-readable output format was requested.
+*/
+func machineOutput() bool {
+	return outputFlag != ""
+}
+
+/*
+checkOutputFlag validates the --output flag before any work is done.
+*/
+func checkOutputFlag() error {
+	switch {
+	case outputFlag == "", outputFlag == formatJSON, outputFlag == formatNDJSON,
+		outputFlag == formatYAML, outputFlag == formatTSV:
+		return nil
+	case strings.Contains(outputFlag, "{{"):
+		if _, err := template.New("output").Parse(outputFlag); err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unrecognized output format: %s", outputFlag)
+	}
+}
+
+/*
+printResults writes results to stdout in the format selected by --output.
+The field names of each result are used as keys, exactly as the json package marshals them.
+Templates are executed once per result, followed by a newline.
+Any error is printed and causes the program to exit.
+*/
+func printResults[T any](results []T) {
+	if err := writeResults(os.Stdout, results); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+}
+
+// writeResults writes results to w in the format selected by --output.
+func writeResults[T any](w io.Writer, results []T) error {
+	// an empty list, not null, for zero results
+	if results == nil {
+		results = []T{}
+	}
+
+	switch outputFlag {
+	case formatJSON:
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case formatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, r := range results {
+			if err := encoder.Encode(r); err != nil {
+				return fmt.Errorf("failed to marshal JSON output: %w", err)
+			}
+		}
+		return nil
+	case formatYAML:
+		return writeYAML(w, results)
+	case formatTSV:
+		return writeTSV(w, results)
+	default:
+		t, err := template.New("output").Parse(outputFlag)
+		if err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		for _, r := range results {
+			if err := t.Execute(w, r); err != nil {
+				return fmt.Errorf("failed to execute output template: %w", err)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+}
+
+/*
+writeYAML writes v as YAML with the same keys and key order as its JSON encoding.
+*/
+func writeYAML(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML output: %w", err)
+	}
+	// JSON is valid YAML; parsing it as a node keeps the field order
+	var node yaml.Node
+	if err = yaml.Unmarshal(b, &node); err != nil {
+		return fmt.Errorf("failed to marshal YAML output: %w", err)
+	}
+	blockStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&node); err != nil {
+		return fmt.Errorf("failed to marshal YAML output: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// blockStyle clears the flow and quoting styles inherited from JSON.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		blockStyle(n)
+	}
+}
+
+/*
+writeTSV writes results as tab-separated values with a header row of field names.
+Lists are joined with commas and nested values are written as JSON.
+*/
+func writeTSV[T any](w io.Writer, results []T) error {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("tsv output is not supported for %s", t)
+	}
+
+	var header []string
+	for f := range t.NumField() {
+		if tsvField(t.Field(f)) {
+			header = append(header, jsonName(t.Field(f)))
+		}
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		v := reflect.ValueOf(r)
+		var row []string
+		for f := range t.NumField() {
+			if tsvField(t.Field(f)) {
+				row = append(row, tsvValue(v.Field(f)))
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonName returns the key the json package uses for a struct field.
+func jsonName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+
+	return f.Name
+}
+
+// tsvField reports whether the field f is included in TSV output: it is exported and not omitted from JSON.
+func tsvField(f reflect.StructField) bool {
+	return f.IsExported() && f.Tag.Get("json") != "-"
+}
+
+// tsvValue formats a single field for TSV output, escaping characters that would break the row.
+func tsvValue(v reflect.Value) string {
+	var s string
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		items := make([]string, v.Len())
+		for i := range v.Len() {
+			items[i] = v.Index(i).String()
+		}
+		s = strings.Join(items, ",")
+	case v.Kind() == reflect.Struct || v.Kind() == reflect.Slice || v.Kind() == reflect.Map:
+		b, _ := json.Marshal(v.Interface())
+		s = string(b)
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+
+	return strings.NewReplacer("\t", "\\t", "\n", "\\n").Replace(s)
+}
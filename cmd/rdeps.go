@@ -0,0 +1,193 @@
+/*
+ * rdeps.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
+)
+
+var rdepsCmd = &cobra.Command{
+	Use:   "rdeps package",
+	Short: "List packages depending on a package",
+	Long: `The rdeps command lists the reverse dependencies of a package: every package that
+depends on it. Installed packages, packages in the configured sync repositories,
+and packages on the AUR are checked by default. Results are grouped by source
+and by kind of dependency.`,
+	Args: cobra.ExactArgs(1),
+	Run:  rdeps,
+}
+
+var rdepsLocalFlag = false
+var rdepsSyncFlag = false
+var rdepsAURFlag = false
+
+func init() {
+	rdepsCmd.PersistentFlags().BoolVarP(&rdepsLocalFlag, "local", "l", false, "Check locally-installed packages")
+	rdepsCmd.PersistentFlags().BoolVarP(&rdepsSyncFlag, "sync", "s", false, "Check packages in the configured sync repositories")
+	rdepsCmd.PersistentFlags().BoolVarP(&rdepsAURFlag, "aur", "a", false, "Check packages on the AUR")
+}
+
+// dependency kinds in display order
+var dependencyKinds = []string{"depends", "optdepends", "makedepends", "checkdepends"}
+
+/*
+A reverseDependency is a single package depending on the target package.
+*/
+type reverseDependency struct {
+	Name   string // the dependent package
+	Source string // "local", a sync repository name, or "aur"
+	Kind   string // depends, optdepends, makedepends, or checkdepends
+}
+
+/*
+A reverseDeps groups the names of dependent packages by kind of dependency.
+*/
+type reverseDeps map[string][]string
+
+func (r reverseDeps) add(kind string, name string) {
+	if !slices.Contains(r[kind], name) {
+		r[kind] = append(r[kind], name)
+	}
+}
+
+func rdeps(cmd *cobra.Command, args []string) {
+	target := args[0]
+	// with no sources selected check all of them
+	if !rdepsLocalFlag && !rdepsSyncFlag && !rdepsAURFlag {
+		rdepsLocalFlag, rdepsSyncFlag, rdepsAURFlag = true, true, true
+	}
+
+	var sources []string
+	results := make(map[string]reverseDeps)
+	failed := false
+
+	if rdepsLocalFlag {
+		pkgs, err := libalpm.GetLocalPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath)
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+		} else if p, ok := pkgs[target]; ok {
+			r := make(reverseDeps)
+			for _, name := range p.RequiredBy {
+				r.add("depends", name)
+			}
+			for _, name := range p.OptionalFor {
+				r.add("optdepends", name)
+			}
+			sources = append(sources, libalpm.LocalDB)
+			results[libalpm.LocalDB] = r
+		}
+	}
+
+	if rdepsSyncFlag {
+		repos, err := libalpm.GetConfigRepos(libalpm.DefaultConfig)
+		if err == nil {
+			repos = libalpm.CheckSyncDBs(repos, libalpm.DefaultDBPath)
+		}
+		var pkgs []libalpm.Package
+		if err == nil {
+			pkgs, err = libalpm.GetSyncPackageDetails(libalpm.DefaultRoot, libalpm.DefaultDBPath, repos)
+		}
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+		}
+		for _, repo := range repos {
+			sources = append(sources, repo)
+			results[repo] = make(reverseDeps)
+		}
+		for _, p := range pkgs {
+			for kind, deps := range map[string][]string{
+				"depends":      p.Depends,
+				"optdepends":   p.OptDepends,
+				"makedepends":  p.MakeDepends,
+				"checkdepends": p.CheckDepends,
+			} {
+				if slices.ContainsFunc(deps, func(d string) bool { return libalpm.DependencyName(d) == target }) {
+					results[p.Repo].add(kind, p.Name)
+				}
+			}
+		}
+	}
+
+	if rdepsAURFlag {
+		r := make(reverseDeps)
+		for kind, t := range map[string]aur.SearchType{
+			"depends":      aur.Depends,
+			"optdepends":   aur.OptDepends,
+			"makedepends":  aur.MakeDepends,
+			"checkdepends": aur.CheckDepends,
+		} {
+			found, err := aur.Search(target, t)
+			if err != nil {
+				fmt.Println(err)
+				failed = true
+				continue
+			}
+			for _, p := range found {
+				r.add(kind, p.Name)
+			}
+		}
+		sources = append(sources, "aur")
+		results["aur"] = r
+	}
+
+	if machineOutput() {
+		var flat []reverseDependency
+		for _, source := range sources {
+			for _, kind := range dependencyKinds {
+				names := results[source][kind]
+				slices.Sort(names)
+				for _, name := range names {
+					flat = append(flat, reverseDependency{name, source, kind})
+				}
+			}
+		}
+		printResults(flat)
+		if failed {
+			os.Exit(exitError)
+		}
+		return
+	}
+	for _, source := range sources {
+		if len(results[source]) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", color.Repo(source))
+		for _, kind := range dependencyKinds {
+			if names := results[source][kind]; len(names) != 0 {
+				slices.Sort(names)
+				fmt.Printf("    %-13s %s\n", kind+":", strings.Join(names, " "))
+			}
+		}
+	}
+	if failed {
+		os.Exit(exitError)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ * repo.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/repo"
+)
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Manage a local pacman repository of built packages",
+	Long: `The repo commands maintain a pacman repository of package files, such as those
+produced by the build command, in the format written by repo-add. A repository
+is named by the path of its database, for example /srv/ourrepo/ourrepo.db.tar.gz,
+and is served to pacman with a section like:
+
+  [ourrepo]
+  Server = file:///srv/ourrepo
+
+Both the package database, name.db.tar.gz, and the files database,
+name.files.tar.gz, are written, along with the name.db and name.files links
+pacman reads. With --sign the databases are signed with gpg; otherwise any
+existing database signatures are removed, as they no longer match.`,
+}
+
+var repoAddCmd = &cobra.Command{
+	Use:   "add database package-file...",
+	Short: "Add package files to a repository",
+	Long: `The add command adds package files to the repository, creating it if it does not
+exist. Package files outside the repository directory are copied into it, along
+with their signatures. An entry for an older version of the same package is
+replaced, and with --prune the older package file is deleted. Adding a package
+older than the version already in the repository fails.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  repoAdd,
+}
+
+var repoRemoveCmd = &cobra.Command{
+	Use:   "remove database package...",
+	Short: "Remove packages from a repository",
+	Long: `The remove command removes the named packages from the repository's databases.
+With --prune their package files are deleted as well.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  repoRemove,
+}
+
+var repoListCmd = &cobra.Command{
+	Use:   "list database",
+	Short: "List the packages in a repository",
+	Args:  cobra.ExactArgs(1),
+	Run:   repoList,
+}
+
+var repoSignFlag = false
+var repoKeyFlag = ""
+var repoPruneFlag = false
+
+func init() {
+	for _, c := range []*cobra.Command{repoAddCmd, repoRemoveCmd} {
+		c.Flags().BoolVarP(&repoSignFlag, "sign", "s", false, "Sign the databases with gpg")
+		c.Flags().StringVarP(&repoKeyFlag, "key", "k", "", "Key to sign with instead of gpg's default key")
+		c.Flags().BoolVarP(&repoPruneFlag, "prune", "R", false, "Delete package files no longer in the repository")
+	}
+	repoCmd.AddCommand(repoAddCmd, repoListCmd, repoRemoveCmd)
+}
+
+/*
+saveRepo writes the repository's databases, then signs them or removes stale signatures.
+*/
+func saveRepo(r *repo.Repo) error {
+	if err := r.Save(); err != nil {
+		return err
+	}
+	if repoSignFlag {
+		return r.Sign(repoKeyFlag)
+	}
+
+	return r.RemoveSignatures()
+}
+
+/*
+copyToRepo copies the file at path, and its signature if there is one, into dir unless it is already there.
+The path of the file in dir is returned along with the files created by copying, which are removed again on error.
+*/
+func copyToRepo(path, dir string) (target string, copied []string, err error) {
+	target = filepath.Join(dir, filepath.Base(path))
+	if src, err := filepath.Abs(path); err != nil {
+		return "", nil, err
+	} else if dst, err := filepath.Abs(target); err != nil {
+		return "", nil, err
+	} else if src == dst {
+		return target, nil, nil
+	}
+
+	defer func() {
+		if err != nil {
+			removeCopies(copied)
+			copied = nil
+		}
+	}()
+	for _, suffix := range []string{"", ".sig"} {
+		in, err := os.Open(path + suffix)
+		if os.IsNotExist(err) && suffix != "" {
+			continue
+		} else if err != nil {
+			return "", copied, fmt.Errorf("failed to open %s: %w", path+suffix, err)
+		}
+		defer in.Close()
+		out, err := os.Create(target + suffix)
+		if err != nil {
+			return "", copied, fmt.Errorf("failed to copy %s: %w", path+suffix, err)
+		}
+		copied = append(copied, target+suffix)
+		if _, err = io.Copy(out, in); err == nil {
+			err = out.Close()
+		} else {
+			out.Close()
+		}
+		if err != nil {
+			return "", copied, fmt.Errorf("failed to copy %s: %w", path+suffix, err)
+		}
+	}
+
+	return target, copied, nil
+}
+
+// removeCopies deletes files copied into the repository directory for a package that was not added.
+func removeCopies(copied []string) {
+	for _, path := range copied {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Println(err)
+		}
+	}
+}
+
+func repoAdd(cmd *cobra.Command, args []string) {
+	r, err := repo.Open(args[0])
+	if err == nil {
+		err = os.MkdirAll(r.Dir, 0755)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	failed := 0
+	for _, path := range args[1:] {
+		target, copied, err := copyToRepo(path, r.Dir)
+		if err != nil {
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		added, old, err := r.Add(target, repoPruneFlag)
+		switch {
+		case err != nil:
+			fmt.Println(err)
+			failed++
+			// a rejected package must not be left in the repository directory
+			if added == nil {
+				removeCopies(copied)
+			}
+		case old != nil:
+			fmt.Printf("Updated %s %s -> %s\n", color.Title(added.Name), color.Version(old.Version), color.Version(added.Version))
+		default:
+			fmt.Printf("Added %s %s\n", color.Title(added.Name), color.Version(added.Version))
+		}
+	}
+
+	if failed == len(args)-1 {
+		os.Exit(exitError)
+	}
+	if err = saveRepo(r); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if failed != 0 {
+		os.Exit(exitPartial)
+	}
+}
+
+func repoRemove(cmd *cobra.Command, args []string) {
+	r, err := repo.Open(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	failed := 0
+	for _, name := range args[1:] {
+		if old, err := r.Remove(name, repoPruneFlag); err != nil {
+			fmt.Println(err)
+			failed++
+		} else {
+			fmt.Printf("Removed %s %s\n", color.Title(old.Name), color.Version(old.Version))
+		}
+	}
+
+	if failed == len(args)-1 {
+		os.Exit(exitNotFound)
+	}
+	if err = saveRepo(r); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if failed != 0 {
+		os.Exit(exitPartial)
+	}
+}
+
+func repoList(cmd *cobra.Command, args []string) {
+	r, err := repo.Open(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	entries := r.List()
+	if machineOutput() {
+		printResults(entries)
+		return
+	}
+	for _, e := range entries {
+		fmt.Println(color.Repo(r.Name+"/") + color.Title(e.Name) + " " + color.Version(e.Version))
+	}
+}
@@ -24,25 +24,149 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
 )
 
 var rootCommand = &cobra.Command{
 	Use:   "pkg",
-	Short: "this is the short info",
-	Long:  "this is the long info",
+	Short: "Manage packages from the Arch User Repository",
+	Long: `pkg queries the AUR and the local pacman databases to search, inspect, fetch,
+build and check for updates to packages from the Arch User Repository, and
+maintains local repositories of the packages it builds.
+
+Most commands accept --output to print their results in a machine-readable
+format instead of text:
+
+  json    a single JSON array of results
+  ndjson  one JSON object per line
+  yaml    a YAML sequence of results
+  tsv     tab-separated values with a header row of field names
+  {{...}} a Go text/template executed for each result
+
+Keys are the field names listed below, in the order listed. Lists are joined
+with commas in tsv output.
+
+  search, info  the AUR package fields returned by the AUR RPC interface:
+                ID, Name, Description, PackageBaseID, PackageBase, Maintainer,
+                NumVotes, Popularity, FirstSubmitted, LastModified, OutOfDate,
+                Version, URLPath, URL, Submitter, License, Depends,
+                MakeDepends, OptDepends, CheckDepends, Provides, Conflicts,
+                Replaces, Groups, Keywords, CoMaintainers
+  foreign       Name, Version, PackageBase, AURVersion, Maintainer, OutOfDate,
+                Classes
+  updates       Name, Version, NewVersion, Source, Ignored
+  orphans       the libalpm package fields: Name, Version, Description, Base,
+                Packager, Repo, InstalledSize, Explicit, Depends, OptDepends,
+                MakeDepends, CheckDepends, Provides, Replaces, Groups,
+                RequiredBy, OptionalFor
+  migrated      Installed and Available, holding libalpm package fields, and
+                Match
+  rdeps         Name, Source, Kind
+  hold          Pattern, Below
+  build         Base, Status, Error, Duration (nanoseconds), Log, Packages
+  repo list     Filename, Name, Base, Version, Description, Groups,
+                CompressedSize, InstalledSize, SHA256Sum, PGPSig, URL, License,
+                Arch, BuildDate, Packager, Replaces, Conflicts, Provides,
+                Depends, OptDepends, MakeDepends, CheckDepends
+  inspect       File, Info, BuildInfo, MTree, Install, Entries and Differences,
+                holding the fields of .PKGINFO, .BUILDINFO and .MTREE, the
+                package's files as Path, Mode, Size and Link, and differences
+                from the AUR as Field, Value and Only
+  audit         Package, File, Line, Severity, Rule, Message, Text
+  keys          Package, Keys as Fingerprint, UserID and Present, and
+                Signatures as Signature, File, Status, Key and Error
+  maintainer    Name, PackageBase, Role, Version, NumVotes, Popularity,
+                LastModified, OutOfDate, Dependents, Upstream, UpstreamStatus,
+                UpstreamError
+  sources       Package, Entry, Name, Path, Status, Cached, Mismatches, Error
+  trust         Name, PackageBase, Score, Minimum, and Factors as Factor,
+                Value, Points, Weight and Detail
+  upstream      Name, Source, AURVersion, Upstream, Status, Error
+
+Timestamps are Unix times; a zero timestamp means the value is not set.
+
+Commands exit with one of the following statuses:
+
+  0    success; for updates and upstream, no updates are available
+  1    an error prevented the command from completing
+  2    partial failure: some packages were not found or could not be checked
+  3    no requested package was found
+  4    checks found problems, such as differences from the AUR's metadata,
+       audit findings above the threshold, sources failing verification,
+       missing PGP keys, or trust scores below the minimum
+  100  updates are available; for upstream, newer upstream versions
+
+Text output is colored following pacman's conventions when --color is always,
+or when it is auto, pacman's Color option is set, NO_COLOR is unset or empty,
+and stdout is a terminal. Machine-readable output is never colored.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkOutputFlag(); err != nil {
+			return err
+		}
+		return setupColor()
+	},
 }
 
+// process exit statuses, documented in the root command's help
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitPartial  = 2
+	exitNotFound = 3
+	exitProblems = 4
+	exitUpdates  = 100
+)
+
 func init() {
+	rootCommand.AddCommand(auditCmd)
+	rootCommand.AddCommand(buildCmd)
 	rootCommand.AddCommand(fetchCmd)
 	rootCommand.AddCommand(foreignCmd)
+	rootCommand.AddCommand(holdCmd)
 	rootCommand.AddCommand(infoCmd)
+	rootCommand.AddCommand(inspectCmd)
+	rootCommand.AddCommand(keysCmd)
+	rootCommand.AddCommand(maintainerCmd)
+	rootCommand.AddCommand(migratedCmd)
+	rootCommand.AddCommand(orphansCmd)
+	rootCommand.AddCommand(rdepsCmd)
+	rootCommand.AddCommand(repoCmd)
 	rootCommand.AddCommand(searchCmd)
+	rootCommand.AddCommand(sourcesCmd)
+	rootCommand.AddCommand(trustCmd)
+	rootCommand.AddCommand(unholdCmd)
 	rootCommand.AddCommand(updatesCmd)
+	rootCommand.AddCommand(upstreamCmd)
 }
 
 func Execute() {
 	if err := rootCommand.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+}
+
+var colorFlag = color.Auto
+
+func init() {
+	rootCommand.PersistentFlags().StringVar(&colorFlag, "color", color.Auto, "Color output: auto, always, or never")
+}
+
+/*
+setupColor enables colored output according to --color and pacman's Color option.
+*/
+func setupColor() (err error) {
+	configured := false
+	if colorFlag == color.Auto {
+		// an unreadable pacman configuration leaves color off
+		if options, err := libalpm.GetConfigOptions(libalpm.DefaultConfig); err == nil {
+			_, configured = options["Color"]
+		}
 	}
+	color.Enabled, err = color.Detect(colorFlag, configured)
+	color.Enabled = color.Enabled && !machineOutput()
+
+	return
 }
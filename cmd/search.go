@@ -20,62 +20,276 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
 )
 
 var searchCmd = &cobra.Command{
-	Use:   "search keyword",
-	Short: "Search AUR packages for the specified keyword",
-	Long: `The search command queries the AUR for any packages matching the given keyword.
+	Use:   "search keyword...",
+	Short: "Search AUR packages for the specified keywords",
+	Long: `The search command queries the AUR for any packages matching the given keywords.
 Searches can be performed on package names, names and descriptions, maintainer,
-etc. The default is to match only on package names.`,
-	Args: cobra.ExactArgs(1),
+etc. The default is to match only on package names.
+
+When several keywords are given each is searched separately and only packages
+matching every keyword are displayed; with --union packages matching any
+keyword are displayed. --by may be repeated to search each keyword by a
+different field: the first --by applies to the first keyword, the second to
+the second keyword, and so on, with the last --by applying to any remaining
+keywords. For example, to find packages with "rust" in their name that depend
+on cargo:
+
+  pkg search --by name --by depends rust cargo
+
+--regex further restricts results to packages whose name or description
+matches a regular expression.
+
+Results are displayed as aur/name, similar to 'pacman -Ss'. Packages already
+installed are marked [installed], or [installed: version] if the installed
+version differs from the AUR's, and flagged packages are marked (Out-of-date).
+--installed and --not-installed restrict results by installation status.
+
+With --interactive the results are numbered and a prompt asks which packages to
+fetch into the current directory. Selections are numbers and ranges, such as
+"1-3 5", and a leading '^' excludes items, so "^4" selects everything except
+the fourth result. Entering '?' and a number displays that result's details.
+When stdin or stdout is not a terminal the results are listed as usual.
+
+Results can be filtered by votes, maintainer, out-of-date status and last
+modification date, sorted by name, votes, popularity, last-modified or
+first-submitted date, and limited to a number of results. Filters are applied
+before sorting, and the limit after sorting.`,
+	Args: cobra.MinimumNArgs(1),
 	Run:  search,
 }
 
-var searchFlag = ""
+var searchFlag = []string{}
+var searchUnionFlag = false
+var searchRegexFlag = ""
+var searchSortFlag = ""
+var searchReverseFlag = false
+var searchMinVotesFlag = 0
+var searchMaintainedFlag = false
+var searchHideOutOfDateFlag = false
+var searchMaintainerFlag = ""
+var searchSinceFlag = ""
+var searchLimitFlag = 0
+var searchInstalledFlag = false
+var searchNotInstalledFlag = false
+var searchInteractiveFlag = false
 
 func init() {
-	searchCmd.PersistentFlags().StringVarP(&searchFlag, "by", "b", "name-desc", "Specify the type of search to perform")
+	flags := searchCmd.PersistentFlags()
+	flags.StringArrayVarP(&searchFlag, "by", "b", []string{"name-desc"}, "Specify the type of search to perform; repeat for each keyword")
+	flags.BoolVarP(&searchUnionFlag, "union", "u", false, "Show packages matching any keyword instead of all keywords")
+	flags.StringVarP(&searchRegexFlag, "regex", "x", "", "Only show packages whose name or description matches this regular expression")
+	flags.StringVarP(&searchSortFlag, "sort", "s", "", "Sort by name, votes, popularity, modified, or submitted")
+	flags.BoolVarP(&searchReverseFlag, "reverse", "r", false, "Sort in descending order")
+	flags.IntVar(&searchMinVotesFlag, "min-votes", 0, "Only show packages with at least this many votes")
+	flags.BoolVar(&searchMaintainedFlag, "maintained-only", false, "Hide packages without a maintainer")
+	flags.BoolVar(&searchHideOutOfDateFlag, "hide-out-of-date", false, "Hide packages flagged out-of-date")
+	flags.StringVar(&searchMaintainerFlag, "maintainer", "", "Only show packages maintained by this user")
+	flags.StringVar(&searchSinceFlag, "since", "", "Only show packages modified on or after this date (YYYY-MM-DD)")
+	flags.IntVarP(&searchLimitFlag, "limit", "l", 0, "Show at most this many results")
+	flags.BoolVar(&searchInstalledFlag, "installed", false, "Only show installed packages")
+	flags.BoolVar(&searchNotInstalledFlag, "not-installed", false, "Only show packages that are not installed")
+	searchCmd.MarkFlagsMutuallyExclusive("installed", "not-installed")
+	flags.BoolVarP(&searchInteractiveFlag, "interactive", "i", false, "Select results to fetch interactively")
+}
+
+// search types accepted by --by
+var searchTypes = map[string]aur.SearchType{
+	"checkdepends":  aur.CheckDepends,
+	"comaintainers": aur.CoMaintainers,
+	"depends":       aur.Depends,
+	"maintainer":    aur.Maintainer,
+	"makedepends":   aur.MakeDepends,
+	"name":          aur.Name,
+	"name-desc":     aur.NameDesc,
+	"optdepends":    aur.OptDepends,
+}
+
+/*
+multiSearch queries the AUR for each keyword and combines the results.
+Keywords are searched with the type at the same index of types, or the last type if there are fewer types than keywords.
+Results are intersected unless --union is set, keeping the order of the first search they appear in.
+*/
+func multiSearch(keywords []string, types []aur.SearchType) (results []aur.Package, err error) {
+	counts := make(map[string]int)
+	for i, keyword := range keywords {
+		t := types[min(i, len(types)-1)]
+		found, err := aur.Search(keyword, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			if counts[p.Name] == 0 {
+				results = append(results, p)
+			}
+			counts[p.Name] += 1
+		}
+	}
+	if !searchUnionFlag {
+		results = slices.DeleteFunc(results, func(p aur.Package) bool { return counts[p.Name] != len(keywords) })
+	}
+
+	return
+}
+
+// comparison functions for each supported sort order
+var searchSorts = map[string]func(a, b aur.Package) int{
+	"name":  func(a, b aur.Package) int { return cmp.Compare(a.Name, b.Name) },
+	"votes": func(a, b aur.Package) int { return cmp.Compare(a.NumVotes, b.NumVotes) },
+	"popularity": func(a, b aur.Package) int {
+		pa, _ := a.Popularity.Float64()
+		pb, _ := b.Popularity.Float64()
+		return cmp.Compare(pa, pb)
+	},
+	"modified":  func(a, b aur.Package) int { return cmp.Compare(a.LastModified, b.LastModified) },
+	"submitted": func(a, b aur.Package) int { return cmp.Compare(a.FirstSubmitted, b.FirstSubmitted) },
+}
+
+/*
+filterResults removes results not matching the filter flags.
+installed holds the versions of locally-installed packages keyed by name.
+*/
+func filterResults(results []aur.Package, installed map[string]string) ([]aur.Package, error) {
+	var pattern *regexp.Regexp
+	if searchRegexFlag != "" {
+		var err error
+		if pattern, err = regexp.Compile(searchRegexFlag); err != nil {
+			return nil, fmt.Errorf("invalid regular expression for --regex: %w", err)
+		}
+	}
+	var since int
+	if searchSinceFlag != "" {
+		t, err := time.ParseInLocation(time.DateOnly, searchSinceFlag, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date for --since: %s", searchSinceFlag)
+		}
+		since = int(t.Unix())
+	}
+
+	return slices.DeleteFunc(results, func(p aur.Package) bool {
+		return p.NumVotes < searchMinVotesFlag ||
+			(searchMaintainedFlag && p.Maintainer == "") ||
+			(searchHideOutOfDateFlag && p.OutOfDate != 0) ||
+			(searchMaintainerFlag != "" && p.Maintainer != searchMaintainerFlag) ||
+			p.LastModified < since ||
+			(pattern != nil && !pattern.MatchString(p.Name) && !pattern.MatchString(p.Description)) ||
+			(searchInstalledFlag && installed[p.Name] == "") ||
+			(searchNotInstalledFlag && installed[p.Name] != "")
+	}), nil
+}
+
+/*
+sortResults orders results according to the sort flags and applies the limit.
+Packages comparing equal are ordered by name.
+*/
+func sortResults(results []aur.Package) ([]aur.Package, error) {
+	if searchSortFlag != "" {
+		compare, ok := searchSorts[searchSortFlag]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized sort order: %s", searchSortFlag)
+		}
+		slices.SortStableFunc(results, func(a, b aur.Package) int {
+			c := cmp.Or(compare(a, b), cmp.Compare(a.Name, b.Name))
+			if searchReverseFlag {
+				return -c
+			}
+			return c
+		})
+	} else if searchReverseFlag {
+		slices.Reverse(results)
+	}
+	if searchLimitFlag > 0 && len(results) > searchLimitFlag {
+		results = results[:searchLimitFlag]
+	}
+
+	return results, nil
 }
 
 func search(cmd *cobra.Command, args []string) {
-	var t aur.SearchType
-	switch searchFlag {
-	case "checkdepends":
-		t = aur.CheckDepends
-	case "depends":
-		t = aur.Depends
-	case "maintainer":
-		t = aur.Maintainer
-	case "makedepends":
-		t = aur.MakeDepends
-	case "name":
-		t = aur.Name
-	case "name-desc":
-		t = aur.NameDesc
-	case "optdepends":
-		t = aur.OptDepends
-	default:
-		fmt.Printf("Unrecognized search type: %s\n\n", searchFlag)
-		flag := cmd.Flag("by")
-		fmt.Printf("%#v\n", flag)
-		cmd.Usage()
-		os.Exit(1)
+	var types []aur.SearchType
+	for _, by := range searchFlag {
+		t, ok := searchTypes[by]
+		if !ok {
+			fmt.Printf("Unrecognized search type: %s\n\n", by)
+			cmd.Usage()
+			os.Exit(exitError)
+		}
+		types = append(types, t)
+	}
+
+	installed, err := libalpm.GetLocalPackages(libalpm.DefaultRoot, libalpm.DefaultDBPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	results, err := multiSearch(args, types)
+	if err == nil {
+		results, err = filterResults(results, installed)
+	}
+	if err == nil {
+		results, err = sortResults(results)
 	}
-	results, err := aur.Search(args[0], t)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
+	if machineOutput() {
+		printResults(results)
+		return
+	}
+	if searchInteractiveFlag && isInteractive() {
+		if err := interactiveSearch(results, installed, os.Stdin); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		return
+	}
 	for _, r := range results {
-		fmt.Println(r.Name + " " + r.Version)
+		fmt.Println(searchLine(r, installed))
 		fmt.Println("    " + r.Description)
 	}
 }
+
+// searchLine formats the first line displayed for a search result.
+func searchLine(p aur.Package, installed map[string]string) string {
+	return color.Repo("aur/") + color.Title(p.Name) + " " + color.Version(p.Version) + installedNote(p, installed) + outOfDateNote(p)
+}
+
+/*
+installedNote returns the annotation for a search result that is installed locally,
+including the installed version if it differs from the AUR's.
+*/
+func installedNote(p aur.Package, installed map[string]string) string {
+	switch version, ok := installed[p.Name]; {
+	case !ok:
+		return ""
+	case libalpm.CompareVersions(version, p.Version) != 0:
+		return " " + color.Meta("[installed: "+version+"]")
+	default:
+		return " " + color.Meta("[installed]")
+	}
+}
+
+// outOfDateNote returns the annotation for a search result flagged out-of-date.
+func outOfDateNote(p aur.Package) string {
+	if p.OutOfDate == 0 {
+		return ""
+	}
+
+	return " " + color.Error("(Out-of-date)")
+}
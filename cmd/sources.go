@@ -0,0 +1,252 @@
+/*
+ * sources.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/sources"
+	"github.com/bmoller/pkg/srcinfo"
+)
+
+var sourcesCmd = &cobra.Command{
+	Use:   "sources package...",
+	Short: "Download package sources and verify their checksums",
+	Long: `The sources command downloads every source listed in the .SRCINFO of each
+package and verifies it against the declared checksums: b2sums, sha512sums,
+sha384sums, sha256sums, sha224sums, sha1sums and md5sums. The .SRCINFO is read
+from the AUR, or from the directory if an argument names a directory containing
+one. Only the sources for the host architecture are checked unless --all-arch
+is set.
+
+Downloads are saved in a cache shared between packages, by default
+$XDG_CACHE_HOME/pkg/sources, in a directory named for the strongest checksum
+of the source. A cached source is verified again and reused rather than being
+downloaded. Sources whose checksums are all SKIP are downloaded on every run and
+reported as skipped. Version control sources are not downloaded.
+
+The exit status is 4 if any source fails to download or does not match its
+checksums.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  sourcesVerify,
+}
+
+var sourcesJobsFlag = 4
+var sourcesCacheDirFlag = ""
+var sourcesAllArchFlag = false
+
+func init() {
+	flags := sourcesCmd.PersistentFlags()
+	flags.IntVarP(&sourcesJobsFlag, "jobs", "j", 4, "Number of sources to download at a time")
+	flags.StringVar(&sourcesCacheDirFlag, "cache-dir", "", "Directory to cache downloads in (default $XDG_CACHE_HOME/pkg/sources)")
+	flags.BoolVarP(&sourcesAllArchFlag, "all-arch", "a", false, "Check the sources of every architecture")
+}
+
+/*
+A sourceResult is the outcome of checking one source of the named package.
+*/
+type sourceResult struct {
+	Package    string
+	Entry      string
+	Name       string
+	Path       string
+	Status     sources.Status
+	Cached     bool
+	Mismatches []string
+	Error      string
+}
+
+/*
+A sourcePackage is a package whose sources are checked, with a function to read the files bundled with it.
+*/
+type sourcePackage struct {
+	name    string
+	info    *srcinfo.SrcInfo
+	open    func(name string) (io.ReadCloser, error)
+	sources []srcinfo.Source
+}
+
+/*
+loadSourcePackages reads the .SRCINFO of each argument, from a local directory or the AUR.
+Packages that cannot be read are reported and counted in failed.
+*/
+func loadSourcePackages(args []string) (packages []sourcePackage, failed int) {
+	var remote []string
+	for _, name := range args {
+		path := filepath.Join(name, ".SRCINFO")
+		if _, err := os.Stat(path); err != nil {
+			remote = append(remote, name)
+			continue
+		}
+		info, err := srcinfo.ParseFile(path)
+		if err != nil {
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		dir := name
+		open := func(file string) (io.ReadCloser, error) { return os.Open(filepath.Join(dir, file)) }
+		packages = append(packages, sourcePackage{name: name, info: info, open: open})
+	}
+
+	var found []aur.Package
+	for batch := range slices.Chunk(remote, infoBatchSize) {
+		results, err := aur.Info(batch)
+		if err != nil {
+			fmt.Println(err)
+			return packages, failed + len(remote)
+		}
+		found = append(found, results...)
+	}
+	for _, name := range remote {
+		i := slices.IndexFunc(found, func(p aur.Package) bool { return p.Name == name })
+		if i < 0 {
+			fmt.Printf("No package with matching name '%s' found\n", name)
+			failed++
+			continue
+		}
+		base := found[i].PackageBase
+		contents, err := aur.GetFile(base, ".SRCINFO")
+		if err == nil {
+			var info *srcinfo.SrcInfo
+			if info, err = srcinfo.Parse(bytes.NewReader(contents)); err == nil {
+				open := func(file string) (io.ReadCloser, error) {
+					contents, err := aur.GetFile(base, file)
+					return io.NopCloser(bytes.NewReader(contents)), err
+				}
+				packages = append(packages, sourcePackage{name: name, info: info, open: open})
+			}
+		}
+		if err != nil {
+			fmt.Printf("%s: %s\n", name, err)
+			failed++
+		}
+	}
+
+	for i, p := range packages {
+		packages[i].sources = slices.DeleteFunc(p.info.Sources(), func(s srcinfo.Source) bool {
+			return !sourcesAllArchFlag && s.Arch != "" && s.Arch != hostArch()
+		})
+	}
+
+	return
+}
+
+/*
+sourceCache returns the download cache in dir, or in the default location if dir is empty.
+*/
+func sourceCache(dir string) (*sources.Cache, error) {
+	if dir == "" {
+		base, err := cacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, "sources")
+	}
+
+	return &sources.Cache{Dir: dir}, nil
+}
+
+func sourcesVerify(cmd *cobra.Command, args []string) {
+	cache, err := sourceCache(sourcesCacheDirFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	packages, failed := loadSourcePackages(args)
+	if len(packages) == 0 {
+		os.Exit(exitError)
+	}
+
+	// check the sources of every package together so downloads run in parallel across packages
+	var requests []sources.Request
+	for _, p := range packages {
+		for _, s := range p.sources {
+			requests = append(requests, sources.Request{Source: s, Open: p.open})
+		}
+	}
+	checked := cache.GetAll(requests, sourcesJobsFlag)
+
+	var results []sourceResult
+	problems := false
+	for _, p := range packages {
+		if !machineOutput() {
+			fmt.Printf("%s %s\n", color.Group("==>"), color.Title(p.name))
+		}
+		for _, r := range checked[:len(p.sources)] {
+			problems = problems || r.Status == sources.Mismatch || r.Status == sources.Failed
+			results = append(results, sourceResult{p.name, r.Entry, r.Name, r.Path, r.Status, r.Cached, r.Mismatches, r.Error})
+			if !machineOutput() {
+				printSourceResult(r)
+			}
+		}
+		checked = checked[len(p.sources):]
+	}
+	if machineOutput() {
+		printResults(results)
+	}
+
+	switch {
+	case problems:
+		os.Exit(exitProblems)
+	case failed != 0:
+		os.Exit(exitPartial)
+	}
+}
+
+// source status colors
+var sourceStatusColors = map[sources.Status]func(string) string{
+	sources.Verified: color.Version,
+	sources.Mismatch: color.Error,
+	sources.Skipped:  color.Warning,
+	sources.Failed:   color.Error,
+	sources.VCS:      color.Meta,
+}
+
+// printSourceResult displays the outcome of checking one source.
+func printSourceResult(r sources.Result) {
+	status := sourceStatusColors[r.Status](fmt.Sprintf("%-9s", r.Status))
+	line := "  " + status + " " + r.Name
+	switch r.Status {
+	case sources.Skipped:
+		line += ": checksum is SKIP"
+	case sources.VCS:
+		line += ": version control source, not downloaded"
+	case sources.Failed:
+		line += ": " + r.Error
+	}
+	if r.Cached {
+		line += " " + color.Meta("(cached)")
+	}
+	fmt.Println(line)
+	for _, m := range r.Mismatches {
+		fmt.Println("            " + m)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * state.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// name of the record listing packages fetched from the AUR
+const fetchedRecord = "aur-packages"
+
+/*
+stateDir returns the directory where pkg keeps records between runs, creating it if needed.
+The location follows the XDG base directory specification.
+*/
+func stateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", ".local", "state")
+}
+
+/*
+configDir returns the directory holding pkg's user configuration, creating it if needed.
+The location follows the XDG base directory specification.
+*/
+func configDir() (string, error) {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+/*
+cacheDir returns the directory where pkg keeps downloaded and built files, creating it if needed.
+The location follows the XDG base directory specification.
+*/
+func cacheDir() (string, error) {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// defaultBuildDir returns the directory packages are fetched into and built in by default.
+func defaultBuildDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "build"), nil
+}
+
+/*
+xdgDir returns the pkg subdirectory of the base directory named by env,
+falling back to fallback under the user's home directory. The directory is created if needed.
+*/
+func xdgDir(env string, fallback ...string) (string, error) {
+	base := os.Getenv(env)
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate home directory: %w", err)
+		}
+		base = filepath.Join(append([]string{home}, fallback...)...)
+	}
+	dir := filepath.Join(base, "pkg")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	return dir, nil
+}
+
+/*
+readRecord loads the lines of the named record in the state directory.
+A record that does not exist yet is empty.
+*/
+func readRecord(name string) (entries []string, err error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open record '%s': %w", name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read record '%s': %w", name, err)
+	}
+
+	return
+}
+
+/*
+addRecord appends entry to the named record in the state directory unless it is already present.
+*/
+func addRecord(name, entry string) error {
+	entries, err := readRecord(name)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(entries, entry) {
+		return nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open record '%s': %w", name, err)
+	}
+	defer f.Close()
+	if _, err = fmt.Fprintln(f, entry); err != nil {
+		return fmt.Errorf("failed to write record '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+/*
+writeRecord replaces the contents of the named record in the state directory with entries.
+*/
+func writeRecord(name string, entries []string) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+
+	contents := strings.Join(entries, "\n")
+	if len(entries) != 0 {
+		contents += "\n"
+	}
+	if err = os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+		return fmt.Errorf("failed to write record '%s': %w", name, err)
+	}
+
+	return nil
+}
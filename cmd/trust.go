@@ -0,0 +1,234 @@
+/*
+ * trust.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/trust"
+)
+
+var trustCmd = &cobra.Command{
+	Use:   "trust package...",
+	Short: "Score how far AUR packages can be trusted from their metadata",
+	Long: `The trust command scores each package from 0 to 100 from signals the AUR
+publishes about it, and lists how much each factor contributed so reviewers can
+see why a package scored low:
+
+  votes                the number of votes, on a logarithmic scale
+  popularity           the AUR's popularity, which weighs recent votes
+  age                  days since the package was first submitted
+  maintained           full points unless the package is orphaned
+  up-to-date           full points unless the package is flagged out of date
+  co-maintainers       the number of co-maintainers
+  maintainer-packages  the number of packages its maintainer maintains
+  churn                full points up to a number of commits to the package
+                       in the churn window, fewer the more commits there are
+
+Each factor earns a share of its weight depending on how close the package comes
+to the factor's target, and the score is the points earned as a percentage of
+the total weight. The weights, targets, churn window and minimum score are read
+from trust.yaml in pkg's configuration directory ($XDG_CONFIG_HOME/pkg), which
+overrides the defaults for any setting it contains:
+
+  minimum: 50
+  churn-window: 30   # days
+  votes: {weight: 20, target: 100}
+  popularity: {weight: 15, target: 1}
+  age: {weight: 15, target: 365}   # days
+  maintained: {weight: 15}
+  up-to-date: {weight: 10}
+  co-maintainers: {weight: 5, target: 1}
+  maintainer-packages: {weight: 10, target: 10}
+  churn: {weight: 10, target: 5}   # commits
+
+A factor with a weight of 0 is not scored. The exit status is 4 if any package
+scores below the minimum, 2 if some packages could not be scored, 3 if none of
+the packages were found, and 1 if none could be scored because of an error.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  trustScore,
+}
+
+var trustConfigFlag = ""
+var trustMinimumFlag = 0.0
+
+func init() {
+	flags := trustCmd.PersistentFlags()
+	flags.StringVar(&trustConfigFlag, "config", "", "Scoring configuration file (default $XDG_CONFIG_HOME/pkg/trust.yaml)")
+	flags.Float64VarP(&trustMinimumFlag, "minimum", "m", 0, "Lowest acceptable score, overriding the configuration")
+}
+
+// name of the scoring configuration file in the configuration directory
+const trustConfigFile = "trust.yaml"
+
+/*
+A trustResult is the score of a package with the contribution of each factor.
+*/
+type trustResult struct {
+	Name        string
+	PackageBase string
+	Score       float64
+	Minimum     float64
+	Factors     []trust.Contribution
+}
+
+/*
+loadTrustConfig reads the scoring configuration from the file given by --config or the configuration directory,
+applying --minimum if it is set.
+*/
+func loadTrustConfig(cmd *cobra.Command) (config trust.Config, err error) {
+	path := trustConfigFlag
+	if path == "" {
+		dir, err := configDir()
+		if err != nil {
+			return trust.Config{}, err
+		}
+		path = filepath.Join(dir, trustConfigFile)
+	}
+	if config, err = trust.LoadConfig(path); err != nil {
+		return trust.Config{}, err
+	}
+	if cmd.Flags().Changed("minimum") {
+		config.Minimum = trustMinimumFlag
+	}
+
+	return
+}
+
+/*
+trustSignals gathers the history of a package that its AUR metadata lacks: the number of packages
+its maintainer maintains and its recent commits. maintained caches package counts by maintainer.
+Lookups are skipped for factors that are not scored.
+*/
+func trustSignals(p aur.Package, config trust.Config, maintained map[string]int, now time.Time) (s trust.Signals, err error) {
+	s.Package = p
+	if config.MaintainerPackages.Weight > 0 && p.Maintainer != "" {
+		n, ok := maintained[p.Maintainer]
+		if !ok {
+			results, err := aur.Search(p.Maintainer, aur.Maintainer)
+			if err != nil {
+				return s, err
+			}
+			n = len(results)
+			maintained[p.Maintainer] = n
+		}
+		s.MaintainerPackages = n
+	}
+
+	if config.Churn.Weight > 0 {
+		commits, err := aur.Log(p.PackageBase)
+		if err != nil {
+			return s, err
+		}
+		since := now.AddDate(0, 0, -config.ChurnWindow)
+		for _, c := range commits {
+			if c.Time.After(since) {
+				s.RecentCommits++
+			}
+		}
+	}
+
+	return
+}
+
+func trustScore(cmd *cobra.Command, args []string) {
+	config, err := loadTrustConfig(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	var found []aur.Package
+	for batch := range slices.Chunk(args, infoBatchSize) {
+		results, err := aur.Info(batch)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		found = append(found, results...)
+	}
+
+	now := time.Now()
+	maintained := make(map[string]int)
+	var results []trustResult
+	notFound, failed := 0, 0
+	for _, name := range args {
+		i := slices.IndexFunc(found, func(p aur.Package) bool { return p.Name == name })
+		if i < 0 {
+			fmt.Printf("No package with matching name '%s' found\n", name)
+			notFound++
+			continue
+		}
+		signals, err := trustSignals(found[i], config, maintained, now)
+		if err != nil {
+			fmt.Printf("%s: %s\n", name, err)
+			failed++
+			continue
+		}
+		score := config.Score(signals, now)
+		results = append(results, trustResult{name, found[i].PackageBase, score.Total, config.Minimum, score.Factors})
+	}
+
+	if machineOutput() {
+		printResults(results)
+	} else {
+		for _, r := range results {
+			printTrustResult(r)
+		}
+	}
+
+	switch {
+	case len(results) == 0 && failed != 0:
+		os.Exit(exitError)
+	case len(results) == 0:
+		os.Exit(exitNotFound)
+	case slices.ContainsFunc(results, func(r trustResult) bool { return r.Score < r.Minimum }):
+		os.Exit(exitProblems)
+	case notFound != 0 || failed != 0:
+		os.Exit(exitPartial)
+	}
+}
+
+// printTrustResult displays the score of a package and each factor's contribution.
+func printTrustResult(r trustResult) {
+	score := fmt.Sprintf("%.1f/100", r.Score)
+	if r.Score < r.Minimum {
+		score = color.Error(score) + fmt.Sprintf(" (below the minimum of %g)", r.Minimum)
+	} else {
+		score = color.Version(score)
+	}
+	fmt.Printf("%s %s %s\n", color.Group("==>"), color.Title(r.Name), score)
+
+	for _, f := range r.Factors {
+		points := fmt.Sprintf("%5.1f/%-3g", f.Points, f.Weight)
+		if f.Points < f.Weight/2 {
+			points = color.Warning(points)
+		}
+		fmt.Printf("  %-19s %s %s\n", f.Factor, points, color.Meta(f.Detail))
+	}
+}
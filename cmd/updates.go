@@ -22,10 +22,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/spf13/cobra"
 
-	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
 	"github.com/bmoller/pkg/libalpm"
 )
 
@@ -33,38 +34,166 @@ var updatesCmd = &cobra.Command{
 	Use:   "updates",
 	Short: "Check the AUR for updates to locally-installed foreign packages",
 	Long: `The updates command queries the AUR for the currently-published version of any
-foreign packages (those returned by 'pacman -Qm'). The total count of foreign
-packages not found on the AUR is displayed after outputting any available
-updates.`,
+foreign packages (those returned by 'pacman -Qm'). The count of foreign
+packages deleted from the AUR and of purely local packages is displayed after
+outputting any available updates; see the foreign command for details.
+
+With --devel, installed VCS packages (-git, -svn, -hg, etc.) are also checked
+by querying the upstream repositories listed in their .SRCINFO and comparing
+the current heads against those recorded when the packages were built with the
+build command. The .SRCINFO is read from the snapshot fetched into the default
+build directory, or from the AUR if the package has not been fetched there.
+A package without a recorded head is compared against the revision in its
+installed version, such as the commit in "r123.gabcdef0"; if the version holds
+no revision the package is reported as unknown until it is built with pkg.
+
+Packages matching pacman's IgnorePkg and IgnoreGroup settings, or held with the
+hold command, are listed separately as ignored updates.
+
+With --quiet only the names of packages with available updates are printed,
+similar to 'checkupdates -q'; ignored updates and counts are omitted.
+
+The exit status is 0 if no updates are available and 100 if any are; ignored
+updates do not count. If some packages could not be looked up on the AUR, some
+VCS sources could not be checked, or some VCS packages are unknown, the status
+is 2, and any other error exits with 1.`,
 	Run:  updates,
 	Args: cobra.NoArgs,
 }
 
+var develFlag = false
+var updatesQuietFlag = false
+
+func init() {
+	updatesCmd.PersistentFlags().BoolVarP(&develFlag, "devel", "d", false, "Check upstream repositories of VCS packages")
+	updatesCmd.PersistentFlags().BoolVarP(&updatesQuietFlag, "quiet", "q", false, "Print only the names of packages with updates")
+}
+
+/*
+An update is an available update to an installed foreign package.
+*/
+type update struct {
+	Name       string
+	Version    string // installed version
+	NewVersion string // version available on the AUR, or the new upstream head of a VCS package
+	Source     string // upstream repository of a VCS package update
+	Ignored    string // reason the update is ignored, if it is
+}
+
+func (u update) String() string {
+	s := fmt.Sprintf("%s %s -> %s", color.Title(u.Name), color.Error(u.Version), color.Version(u.NewVersion))
+	if u.Source != "" {
+		s += fmt.Sprintf(" (%s)", u.Source)
+	}
+	if u.Ignored != "" {
+		s += " " + color.Warning("["+u.Ignored+"]")
+	}
+
+	return s
+}
+
 func updates(cmd *cobra.Command, args []string) {
-	syncRepos, err := libalpm.GetConfigRepos(libalpm.DefaultConfig)
+	pkgs, unchecked, err := getForeignPackages()
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
-	foreignPkgs, err := libalpm.GetForeignPackages(libalpm.DefaultRoot, libalpm.DefaultDBPath, syncRepos)
+	ignores, err := loadIgnoreList()
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
-	notFound := 0
-	for pkg, ver := range foreignPkgs {
-		switch info, err := aur.Info([]string{pkg}); {
-		case err != nil:
+	var available []update
+	deleted, local := 0, 0
+	for _, p := range pkgs {
+		switch {
+		case slices.Contains(p.Classes, classDeleted):
+			deleted += 1
+		case slices.Contains(p.Classes, classLocal):
+			local += 1
+		case libalpm.CompareVersions(p.Version, p.AURVersion) < 0:
+			available = append(available, update{
+				Name:       p.Name,
+				Version:    p.Version,
+				NewVersion: p.AURVersion,
+				Ignored:    ignores.reason(p.Name, p.AURVersion),
+			})
+		}
+	}
+	failed := 0
+	var unknown []string
+	if develFlag {
+		var develUpdates []develUpdate
+		buildDir, err := defaultBuildDir()
+		if err == nil {
+			develUpdates, unknown, failed, err = checkDevelUpdates(pkgs, buildDir)
+		}
+		if err != nil {
 			fmt.Println(err)
-			notFound += 1
-		case len(info) != 1:
-			notFound += 1
-		case libalpm.CompareVersions(ver, info[0].Version) < 0:
-			fmt.Printf("%s %s -> %s\n", pkg, ver, info[0].Version)
+			os.Exit(exitError)
 		}
+		for _, u := range develUpdates {
+			available = append(available, update{
+				Name:       u.Name,
+				Version:    u.Version,
+				NewVersion: shortHead(u.Upstream),
+				Source:     u.URL,
+				Ignored:    ignores.reason(u.Name, ""),
+			})
+		}
+	}
+
+	ignored := slices.DeleteFunc(slices.Clone(available), func(u update) bool { return u.Ignored == "" })
+	pending := slices.DeleteFunc(slices.Clone(available), func(u update) bool { return u.Ignored != "" })
+	switch {
+	case machineOutput():
+		printResults(available)
+	case updatesQuietFlag:
+		for _, u := range pending {
+			fmt.Println(u.Name)
+		}
+	default:
+		printUpdates(pending, ignored, unknown, unchecked, failed, deleted, local)
+	}
+
+	switch {
+	case unchecked != 0 || failed != 0 || len(unknown) != 0:
+		os.Exit(exitPartial)
+	case len(pending) != 0:
+		os.Exit(exitUpdates)
+	}
+}
+
+/*
+printUpdates displays pending and ignored updates, and unknown VCS packages, followed by counts of packages that could not be checked.
+*/
+func printUpdates(pending, ignored []update, unknown []string, unchecked, failed, deleted, local int) {
+	for _, u := range pending {
+		fmt.Println(u)
+	}
+	if len(ignored) != 0 {
+		fmt.Println(color.Group("Ignored updates:"))
+		for _, u := range ignored {
+			fmt.Printf("    %s\n", u)
+		}
+	}
+	if len(unknown) != 0 {
+		fmt.Println(color.Group("Unknown VCS packages:"))
+		for _, name := range unknown {
+			fmt.Printf("    %s\n", color.Title(name))
+		}
+	}
+	if unchecked != 0 {
+		fmt.Printf("%d packages could not be looked up on the AUR.\n", unchecked)
+	}
+	if failed != 0 {
+		fmt.Printf("%d VCS sources could not be checked.\n", failed)
+	}
+	if deleted != 0 {
+		fmt.Printf("%d packages deleted from the AUR.\n", deleted)
 	}
-	if notFound != 0 {
-		fmt.Printf("%d packages not found on the AUR.\n", notFound)
+	if local != 0 {
+		fmt.Printf("%d local packages not found on the AUR.\n", local)
 	}
 }
@@ -0,0 +1,286 @@
+/*
+ * upstream.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bmoller/pkg/aur"
+	"github.com/bmoller/pkg/color"
+	"github.com/bmoller/pkg/libalpm"
+	"github.com/bmoller/pkg/upstream"
+)
+
+var upstreamCmd = &cobra.Command{
+	Use:   "upstream [package...]",
+	Short: "Check AUR packages for newer upstream releases",
+	Long: `The upstream command looks up the latest version released by the upstream
+project of each package and lists the packages whose version on the AUR is
+older, so they can be bumped. With no arguments every configured package is
+checked.
+
+Where to look is configured per package in upstream.yaml in pkg's
+configuration directory ($XDG_CONFIG_HOME/pkg), a mapping of package names to
+sources:
+
+  foo:
+    source: github        # latest release; GITHUB_TOKEN is used if set
+    repo: owner/foo
+    prefix: v             # removed from versions
+  bar:
+    source: gitlab        # latest release; GITLAB_TOKEN is used if set
+    repo: group/bar
+  baz:
+    source: regex         # highest version matched in a web page
+    url: https://example.com/downloads/
+    regex: baz-([0-9.]+)\.tar\.gz
+  qux:
+    source: git           # highest version among the repository's tags
+    url: https://example.com/qux.git
+  python-quux:
+    source: pypi
+    name: quux
+  corge:
+    source: crates        # latest stable version on crates.io
+    name: corge
+
+For every source but regex, regex is optional and selects the tags to consider;
+its first group, if it has one, is the version. The github, gitlab, pypi and
+crates sources accept api, the base URL of the service, for self-hosted
+instances. Versions are compared with the AUR's pkgver, without its epoch and
+pkgrel, using pacman's version comparison.
+
+The exit status is 100 if any package needs a newer version, and 2 if some
+packages could not be checked.`,
+	Run: upstreamCheck,
+}
+
+var upstreamConfigFlag = ""
+var upstreamAllFlag = false
+var upstreamQuietFlag = false
+var upstreamJobsFlag = 4
+
+func init() {
+	flags := upstreamCmd.PersistentFlags()
+	flags.StringVar(&upstreamConfigFlag, "config", "", "Upstream configuration file (default $XDG_CONFIG_HOME/pkg/upstream.yaml)")
+	flags.BoolVarP(&upstreamAllFlag, "all", "a", false, "Also list packages that are up to date")
+	flags.BoolVarP(&upstreamQuietFlag, "quiet", "q", false, "Only print the names of packages needing a newer version")
+	flags.IntVarP(&upstreamJobsFlag, "jobs", "j", 4, "Number of packages to check at a time")
+}
+
+// name of the upstream configuration file in the configuration directory
+const upstreamConfigFile = "upstream.yaml"
+
+// statuses of an upstreamResult
+const (
+	upstreamOutdated = "outdated" // upstream has released a newer version
+	upstreamCurrent  = "current"  // the AUR has the latest upstream version
+	upstreamAhead    = "ahead"    // the AUR's version is newer than upstream's, which suggests a misconfigured source
+	upstreamError    = "error"    // the upstream version could not be found
+)
+
+/*
+An upstreamResult compares the AUR version of a package with the latest upstream version.
+*/
+type upstreamResult struct {
+	Name       string
+	Source     string // kind of upstream source
+	AURVersion string
+	Upstream   string
+	Status     string
+	Error      string
+}
+
+/*
+loadUpstreamConfig reads the upstream configuration from the file given by --config or the configuration directory.
+*/
+func loadUpstreamConfig() (upstream.Config, error) {
+	path := upstreamConfigFlag
+	if path == "" {
+		dir, err := configDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, upstreamConfigFile)
+	}
+
+	return upstream.LoadConfig(path)
+}
+
+// pkgver returns the pkgver part of a full version, without its epoch and pkgrel.
+func pkgver(version string) string {
+	if _, v, ok := strings.Cut(version, ":"); ok {
+		version = v
+	}
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version = version[:i]
+	}
+
+	return version
+}
+
+/*
+checkUpstream looks up the upstream versions of the packages with a source in config, checking up to jobs at a time.
+Packages without a source are skipped. Results are in the order of packages.
+*/
+func checkUpstream(config upstream.Config, packages []aur.Package, jobs int) []upstreamResult {
+	packages = slices.DeleteFunc(slices.Clone(packages), func(p aur.Package) bool {
+		_, ok := config[p.Name]
+		return !ok
+	})
+	results := make([]upstreamResult, len(packages))
+	checker := &upstream.Checker{}
+	limit := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i, p := range packages {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			source := config[p.Name]
+			r := upstreamResult{Name: p.Name, Source: source.Kind, AURVersion: p.Version}
+			version, err := checker.Latest(source)
+			switch c := libalpm.CompareVersions(version, pkgver(p.Version)); {
+			case err != nil:
+				r.Status, r.Error = upstreamError, err.Error()
+			case c > 0:
+				r.Status, r.Upstream = upstreamOutdated, version
+			case c < 0:
+				r.Status, r.Upstream = upstreamAhead, version
+			default:
+				r.Status, r.Upstream = upstreamCurrent, version
+			}
+			results[i] = r
+			<-limit
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func upstreamCheck(cmd *cobra.Command, args []string) {
+	config, err := loadUpstreamConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+
+	names := args
+	if len(names) == 0 {
+		if len(config) == 0 {
+			fmt.Println("No packages are configured in " + upstreamConfigFile)
+			os.Exit(exitError)
+		}
+		names = slices.Sorted(maps.Keys(config))
+	}
+	failed := 0
+	names = slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		if _, ok := config[name]; !ok {
+			fmt.Printf("No upstream source configured for '%s'\n", name)
+			failed++
+			return true
+		}
+		return false
+	})
+
+	var found []aur.Package
+	for batch := range slices.Chunk(names, infoBatchSize) {
+		results, err := aur.Info(batch)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		found = append(found, results...)
+	}
+	var packages []aur.Package
+	for _, name := range names {
+		if i := slices.IndexFunc(found, func(p aur.Package) bool { return p.Name == name }); i >= 0 {
+			packages = append(packages, found[i])
+		} else {
+			fmt.Printf("No package with matching name '%s' found\n", name)
+			failed++
+		}
+	}
+
+	results := checkUpstream(config, packages, upstreamJobsFlag)
+	outdated, errors := 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case upstreamOutdated:
+			outdated++
+		case upstreamError:
+			errors++
+		}
+	}
+
+	switch {
+	case machineOutput():
+		printResults(results)
+	case upstreamQuietFlag:
+		for _, r := range results {
+			if r.Status == upstreamOutdated {
+				fmt.Println(r.Name)
+			}
+		}
+	default:
+		for _, r := range results {
+			if r.Status != upstreamCurrent || upstreamAllFlag {
+				printUpstreamResult(r)
+			}
+		}
+	}
+
+	switch {
+	case len(results) == 0:
+		os.Exit(exitNotFound)
+	case errors == len(results):
+		os.Exit(exitError)
+	case failed != 0 || errors != 0:
+		os.Exit(exitPartial)
+	case outdated != 0:
+		os.Exit(exitUpdates)
+	}
+}
+
+// printUpstreamResult displays the AUR and upstream versions of a package.
+func printUpstreamResult(r upstreamResult) {
+	s := color.Title(r.Name) + " "
+	switch r.Status {
+	case upstreamOutdated:
+		s += fmt.Sprintf("%s -> %s", color.Error(r.AURVersion), color.Version(r.Upstream))
+	case upstreamCurrent:
+		s += color.Version(r.AURVersion)
+	case upstreamAhead:
+		s += fmt.Sprintf("%s %s", color.Version(r.AURVersion), color.Warning("(newer than upstream "+r.Upstream+")"))
+	case upstreamError:
+		s += color.Error(r.Error)
+	}
+
+	fmt.Printf("%s (%s)\n", s, r.Source)
+}
@@ -0,0 +1,102 @@
+/*
+ * color.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package color styles terminal output with ANSI escape sequences, following pacman's color scheme.
+Styling is disabled until Enabled is set, typically from the result of Detect.
+*/
+package color
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Enabled controls whether the styling functions add escape sequences.
+var Enabled = false
+
+// color modes accepted by Detect
+const (
+	Auto   = "auto"
+	Always = "always"
+	Never  = "never"
+)
+
+// ANSI escape sequences
+const (
+	reset   = "\033[0m"
+	bold    = "\033[1m"
+	red     = "\033[1;31m"
+	green   = "\033[1;32m"
+	yellow  = "\033[1;33m"
+	blue    = "\033[1;34m"
+	magenta = "\033[1;35m"
+	cyan    = "\033[1;36m"
+)
+
+/*
+Detect decides whether output should be colored for the given mode.
+In Auto mode color is used only if pacman's Color option is set (configured),
+the NO_COLOR environment variable is unset or empty, and stdout is a terminal.
+An unrecognized mode is returned as an error.
+*/
+func Detect(mode string, configured bool) (bool, error) {
+	switch mode {
+	case Always:
+		return true, nil
+	case Never:
+		return false, nil
+	case Auto:
+		noColor := os.Getenv("NO_COLOR") != ""
+		return configured && !noColor && term.IsTerminal(int(os.Stdout.Fd())), nil
+	default:
+		return false, fmt.Errorf("unrecognized color mode: %s", mode)
+	}
+}
+
+func style(code, s string) string {
+	if !Enabled || s == "" {
+		return s
+	}
+
+	return code + s + reset
+}
+
+// Title styles labels and package names.
+func Title(s string) string { return style(bold, s) }
+
+// Repo styles repository names.
+func Repo(s string) string { return style(magenta, s) }
+
+// Version styles package versions.
+func Version(s string) string { return style(green, s) }
+
+// Group styles package groups and section headers.
+func Group(s string) string { return style(blue, s) }
+
+// Meta styles notes such as [installed].
+func Meta(s string) string { return style(cyan, s) }
+
+// Warning styles warnings.
+func Warning(s string) string { return style(yellow, s) }
+
+// Error styles errors and out-of-date notices.
+func Error(s string) string { return style(red, s) }
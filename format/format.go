@@ -0,0 +1,254 @@
+/*
+ * format.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package format lays out text for display in a terminal.
+Widths are measured in terminal columns rather than bytes, so text containing
+wide East Asian characters, combining marks, or ANSI escape sequences aligns correctly.
+*/
+package format
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+
+	"github.com/bmoller/pkg/color"
+)
+
+// DefaultWidth is the terminal width assumed when the actual width cannot be determined.
+const DefaultWidth = 80
+
+// DefaultIndent is the column at which values start in pacman-style package details.
+const DefaultIndent = 18
+
+/*
+Width returns the number of terminal columns needed to display s.
+Wide and fullwidth characters take two columns; combining marks, format
+characters, control characters, and ANSI escape sequences take none.
+*/
+func Width(s string) (columns int) {
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			i += escapeLength(s[i:])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		columns += RuneWidth(r)
+		i += size
+	}
+
+	return
+}
+
+/*
+RuneWidth returns the number of terminal columns needed to display r.
+*/
+func RuneWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// escapeLength returns the length of the ANSI CSI sequence at the start of s.
+func escapeLength(s string) int {
+	if len(s) < 2 || s[1] != '[' {
+		return 1
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+/*
+TerminalWidth returns the width of the terminal attached to f, or DefaultWidth if f is not a terminal.
+*/
+func TerminalWidth(f *os.File) int {
+	w, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || w <= 0 {
+		return DefaultWidth
+	}
+
+	return w
+}
+
+/*
+A Formatter lays out values that start at column Indent of a line Width columns wide,
+such as the values following the labels of pacman's package details.
+Continuation lines are indented to the same column.
+*/
+type Formatter struct {
+	Width  int // total width of a line in columns
+	Indent int // column at which values start
+}
+
+/*
+Terminal returns a Formatter for the terminal attached to stdout with the default indent.
+*/
+func Terminal() Formatter {
+	return Formatter{Width: TerminalWidth(os.Stdout), Indent: DefaultIndent}
+}
+
+// available returns the number of columns left for values, never less than one.
+func (f Formatter) available() int {
+	return max(f.Width-f.Indent, 1)
+}
+
+// padding returns the indent of continuation lines.
+func (f Formatter) padding() string {
+	return strings.Repeat(" ", f.Indent)
+}
+
+/*
+Label displays name as the label of a value starting at column Indent, as pacman labels package details:
+the name is padded to end two columns before Indent and followed by a colon.
+*/
+func (f Formatter) Label(name string) string {
+	return color.Title(name+strings.Repeat(" ", max(f.Indent-2-Width(name), 0))) + ": "
+}
+
+/*
+List lays out items separated by two spaces, as pacman displays lists, wrapping between items.
+An empty list is displayed as "None". The result ends with a newline.
+*/
+func (f Formatter) List(items []string) string {
+	if len(items) == 0 {
+		return "None\n"
+	}
+
+	output := ""
+	length := 0
+	for _, s := range items {
+		w := Width(s)
+		if length > 0 && length+w+2 > f.available() {
+			output += "\n" + f.padding()
+			length = 0
+		}
+		output += s + "  "
+		length += w + 2
+	}
+
+	return output + "\n"
+}
+
+/*
+Text lays out free text, wrapping between words.
+Words too long to fit on a line by themselves are broken between characters.
+The result ends with a newline.
+*/
+func (f Formatter) Text(s string) string {
+	var lines []string
+	line, length := "", 0
+	for _, word := range strings.Fields(s) {
+		for _, part := range f.split(word) {
+			w := Width(part)
+			switch {
+			case length == 0:
+				line, length = part, w
+			case length+1+w > f.available():
+				lines = append(lines, line)
+				line, length = part, w
+			default:
+				line += " " + part
+				length += 1 + w
+			}
+		}
+	}
+	lines = append(lines, line)
+
+	return strings.Join(lines, "\n"+f.padding()) + "\n"
+}
+
+/*
+Lines lays out each item on its own line, wrapping each as free text.
+An empty list is displayed as "None". The result ends with a newline.
+*/
+func (f Formatter) Lines(items []string) string {
+	if len(items) == 0 {
+		return "None\n"
+	}
+
+	output := ""
+	for i, item := range items {
+		if i > 0 {
+			output += f.padding()
+		}
+		output += f.Text(item)
+	}
+
+	return output
+}
+
+// split breaks a word wider than the available columns into pieces that fit.
+func (f Formatter) split(word string) (parts []string) {
+	if Width(word) <= f.available() {
+		return []string{word}
+	}
+
+	part, length := "", 0
+	for _, r := range word {
+		w := RuneWidth(r)
+		if length > 0 && length+w > f.available() {
+			parts = append(parts, part)
+			part, length = "", 0
+		}
+		part += string(r)
+		length += w
+	}
+
+	return append(parts, part)
+}
+
+// OrNone substitutes "None" for an empty value, as pacman does.
+func OrNone(s string) string {
+	if s == "" {
+		return "None"
+	}
+
+	return s
+}
+
+/*
+Size renders a size in bytes using binary units, similar to pacman's output.
+*/
+func Size(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
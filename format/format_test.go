@@ -0,0 +1,112 @@
+/*
+ * format_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package format
+
+import "testing"
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "pacman", 6},
+		{"wide", "日本語", 6},
+		{"fullwidth", "ＡＢ", 4},
+		{"combining mark", "é", 1},
+		{"ansi escape", "\033[1;32mcore\033[0m", 4},
+		{"mixed", "a日\033[0mb", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Width(tt.s); got != tt.want {
+				t.Errorf("Width(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatterList(t *testing.T) {
+	tests := []struct {
+		name  string
+		f     Formatter
+		items []string
+		want  string
+	}{
+		{"empty", Formatter{Width: 80, Indent: 18}, nil, "None\n"},
+		{"fits", Formatter{Width: 80, Indent: 18}, []string{"glibc", "zlib"}, "glibc  zlib  \n"},
+		{"wraps", Formatter{Width: 30, Indent: 18}, []string{"glibc", "zlib", "bash"}, "glibc  \n                  zlib  bash  \n"},
+		{"wide runes", Formatter{Width: 20, Indent: 10}, []string{"日本", "語", "中文"}, "日本  語  \n          中文  \n"},
+		{"no indent", Formatter{Width: 13, Indent: 0}, []string{"glibc", "zlib", "bash"}, "glibc  zlib  \nbash  \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.List(tt.items); got != tt.want {
+				t.Errorf("List(%q) = %q, want %q", tt.items, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatterText(t *testing.T) {
+	tests := []struct {
+		name string
+		f    Formatter
+		s    string
+		want string
+	}{
+		{"empty", Formatter{Width: 80, Indent: 18}, "", "\n"},
+		{"fits", Formatter{Width: 80, Indent: 18}, "A package manager", "A package manager\n"},
+		{"collapses spaces", Formatter{Width: 80, Indent: 18}, "  two   words ", "two words\n"},
+		{"wraps", Formatter{Width: 28, Indent: 18}, "the quick brown fox", "the quick\n                  brown fox\n"},
+		{"indent", Formatter{Width: 14, Indent: 4}, "aaaa bbbb cccc", "aaaa bbbb\n    cccc\n"},
+		{"wide runes", Formatter{Width: 9, Indent: 4}, "日本 語中文", "日本\n    語中\n    文\n"},
+		{"long word", Formatter{Width: 10, Indent: 4}, "abcdefghijklm", "abcdef\n    ghijkl\n    m\n"},
+		{"long word between words", Formatter{Width: 10, Indent: 4}, "ab abcdefghij cd", "ab\n    abcdef\n    ghij\n    cd\n"},
+		{"no room", Formatter{Width: 4, Indent: 10}, "abc", "a\n          b\n          c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Text(tt.s); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatterLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		f     Formatter
+		items []string
+		want  string
+	}{
+		{"empty", Formatter{Width: 80, Indent: 18}, nil, "None\n"},
+		{"one per line", Formatter{Width: 80, Indent: 4}, []string{"python: scripts", "bash"}, "python: scripts\n    bash\n"},
+		{"wraps each", Formatter{Width: 14, Indent: 4}, []string{"aaaa bbbb cccc", "dd"}, "aaaa bbbb\n    cccc\n    dd\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Lines(tt.items); got != tt.want {
+				t.Errorf("Lines(%q) = %q, want %q", tt.items, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,13 @@ module github.com/bmoller/pkg
 go 1.23
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.8.1
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.26.0
 	golang.org/x/term v0.23.0
+	golang.org/x/text v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,101 @@
+/*
+ * deps.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libalpm
+
+import (
+	"slices"
+	"strings"
+)
+
+/*
+DependencyName extracts the bare package name from a dependency string.
+Version constraints such as ">=1.0" and optional dependency descriptions are discarded.
+*/
+func DependencyName(dep string) string {
+	if i := strings.Index(dep, ":"); i >= 0 {
+		dep = dep[:i]
+	}
+	if i := strings.IndexAny(dep, "<>="); i >= 0 {
+		dep = dep[:i]
+	}
+
+	return strings.TrimSpace(dep)
+}
+
+/*
+FindOrphans returns the sorted names of packages in pkgs that were installed as dependencies but are no longer required.
+pkgs is expected to come from GetLocalPackageDetails so that RequiredBy and OptionalFor are populated.
+If optional is true, a package optionally required by another package is not considered an orphan.
+If recursive is true, packages that are only required by other orphans are orphans as well;
+this is equivalent to finding every dependency not reachable from an explicitly-installed package.
+*/
+func FindOrphans(pkgs map[string]Package, optional, recursive bool) (orphans []string) {
+	requirers := func(p Package) []string {
+		if optional {
+			return slices.Concat(p.RequiredBy, p.OptionalFor)
+		}
+		return p.RequiredBy
+	}
+
+	if !recursive {
+		for name, p := range pkgs {
+			if !p.Explicit && len(requirers(p)) == 0 {
+				orphans = append(orphans, name)
+			}
+		}
+		slices.Sort(orphans)
+		return
+	}
+
+	// invert the required-by graph so it can be walked from explicit packages down
+	requires := make(map[string][]string)
+	for name, p := range pkgs {
+		for _, r := range requirers(p) {
+			requires[r] = append(requires[r], name)
+		}
+	}
+	needed := make(map[string]bool)
+	var queue []string
+	for name, p := range pkgs {
+		if p.Explicit {
+			needed[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dep := range requires[name] {
+			if !needed[dep] {
+				needed[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	for name := range pkgs {
+		if !needed[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	slices.Sort(orphans)
+
+	return
+}
@@ -25,6 +25,7 @@ import (
 	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -38,6 +39,36 @@ const DefaultDBPath = "/var/lib/pacman"
 // DefaultRoot is the default root path of the pacman installation.
 const DefaultRoot = "/"
 
+// LocalDB is the name libalpm reports for the database of installed packages.
+const LocalDB = "local"
+
+/*
+A Package holds the details libalpm tracks for a single package, either one
+installed locally or one available from a sync repository.
+Relationship fields hold dependency strings as formatted by libalpm, e.g.
+"glibc>=2.40" or "python: for the helper scripts".
+*/
+type Package struct {
+	Name          string
+	Version       string
+	Description   string
+	Base          string
+	Packager      string
+	Repo          string   // name of the database the package was read from
+	InstalledSize int64    // size in bytes of the installed package
+	Explicit      bool     // the package was installed explicitly, not as a dependency
+	Depends       []string // runtime dependencies
+	OptDepends    []string // optional dependencies and their descriptions
+	MakeDepends   []string // build-time dependencies
+	CheckDepends  []string // dependencies required to run a package's tests
+	Provides      []string
+	Replaces      []string
+	Groups        []string
+	RequiredBy    []string // installed packages depending on this one; local packages only
+	OptionalFor   []string // installed packages optionally depending on this one; local packages only
+	Signed        bool     // a PGP signature was validated when the package was installed; local packages only
+}
+
 /*
 GetConfigRepos loads the specified pacman configuration file at path and
 extracts any configured repository names. Any error is returned with an
@@ -68,6 +99,48 @@ func GetConfigRepos(path string) (names []string, err error) {
 	return
 }
 
+/*
+GetConfigOptions loads the specified pacman configuration file at path and
+extracts the settings of its [options] section. Keys are option names; values
+hold every whitespace-separated value given for the option, across repeated
+lines. Options without a value, such as Color, are present with no values.
+Any error is returned with an explanatory message in err.
+*/
+func GetConfigOptions(path string) (options map[string][]string, err error) {
+	file, err := os.Open(path)
+	if err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("file at %s does not exist", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("unknown error: %w", err)
+	}
+	defer file.Close()
+
+	options = make(map[string][]string)
+	section := ""
+	config := bufio.NewScanner(file)
+	for config.Scan() {
+		line := strings.TrimSpace(config.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case len(line) > 2 && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line[1 : len(line)-1]
+		case section != "options" || line == "":
+			continue
+		default:
+			key, value, _ := strings.Cut(line, "=")
+			key = strings.TrimSpace(key)
+			options[key] = append(options[key], strings.Fields(value)...)
+		}
+	}
+	if err = config.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading pacman config: %w", err)
+	}
+
+	return
+}
+
 func CheckSyncDBs(names []string, dbPath string) (found []string) {
 	for _, entry := range names {
 		dbPath := filepath.Join(dbPath, "sync", fmt.Sprintf("%s.db", entry))
@@ -96,3 +169,67 @@ func GetForeignPackages(root, dbPath string, repos []string) (pkgs map[string]st
 
 	return
 }
+
+/*
+A Migration pairs a locally-built package with a sync repository package that can replace it.
+*/
+type Migration struct {
+	Installed Package // the locally-installed package
+	Available Package // the sync repository package now offering it
+	Match     string  // how the packages were matched: "name", "provides", or "replaces"
+}
+
+/*
+FindMigrated finds locally-built packages that are now available from a sync repository.
+local should come from GetLocalPackageDetails and sync from GetSyncPackageDetails.
+A package with the same name as a sync package matches if no PGP signature was validated when it was installed,
+as sync repository packages are signed but packages built locally, such as from the AUR, are not.
+A foreign package, one whose name is not in the sync repos, matches when a sync package has a name
+listed in its Provides or Replaces, or when a sync package lists it in its own Replaces.
+Results are sorted by the name of the installed package.
+*/
+func FindMigrated(local map[string]Package, sync []Package) (migrations []Migration) {
+	byName := make(map[string]Package)
+	replacedBy := make(map[string]Package)
+	for _, p := range sync {
+		if _, ok := byName[p.Name]; !ok {
+			byName[p.Name] = p
+		}
+		for _, r := range p.Replaces {
+			if _, ok := replacedBy[DependencyName(r)]; !ok {
+				replacedBy[DependencyName(r)] = p
+			}
+		}
+	}
+
+	names := slices.Sorted(maps.Keys(local))
+	for _, name := range names {
+		installed := local[name]
+		if p, ok := byName[name]; ok {
+			if !installed.Signed {
+				migrations = append(migrations, Migration{installed, p, "name"})
+			}
+			continue
+		}
+		if m, ok := matchRelation(installed, installed.Provides, byName, "provides"); ok {
+			migrations = append(migrations, m)
+		} else if m, ok := matchRelation(installed, installed.Replaces, byName, "replaces"); ok {
+			migrations = append(migrations, m)
+		} else if p, ok := replacedBy[name]; ok {
+			migrations = append(migrations, Migration{installed, p, "replaces"})
+		}
+	}
+
+	return
+}
+
+// matchRelation finds the first of deps that names a package in byName.
+func matchRelation(installed Package, deps []string, byName map[string]Package, kind string) (Migration, bool) {
+	for _, dep := range deps {
+		if p, ok := byName[DependencyName(dep)]; ok {
+			return Migration{installed, p, kind}, true
+		}
+	}
+
+	return Migration{}, false
+}
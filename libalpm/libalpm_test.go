@@ -0,0 +1,60 @@
+/*
+ * libalpm_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package libalpm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindMigrated(t *testing.T) {
+	sync := []Package{
+		{Name: "foo", Version: "2.0-1", Repo: "extra"},
+		{Name: "iptables", Version: "1.8-1", Repo: "core"},
+		{Name: "iptables-nft", Version: "1.8-1", Repo: "extra", Provides: []string{"iptables"}},
+		{Name: "libbar", Version: "3.0-1", Repo: "extra"},
+		{Name: "newbaz", Version: "1.0-1", Repo: "extra", Replaces: []string{"baz"}},
+		{Name: "qux", Version: "1.0-1", Repo: "extra"},
+		{Name: "foo", Version: "1.9-1", Repo: "testing"},
+	}
+	local := map[string]Package{
+		"foo":          {Name: "foo", Version: "1.0-1"},
+		"iptables-nft": {Name: "iptables-nft", Version: "1.8-1", Provides: []string{"iptables"}, Signed: true},
+		"bar-git":      {Name: "bar-git", Version: "r1.gabcdef0-1", Provides: []string{"libbar=3.0"}},
+		"baz":          {Name: "baz", Version: "0.9-1"},
+		"qux-bin":      {Name: "qux-bin", Version: "1.0-1", Replaces: []string{"qux"}},
+		"qux":          {Name: "qux", Version: "1.0-1", Signed: true},
+		"unrelated":    {Name: "unrelated", Version: "1.0-1", Provides: []string{"something"}},
+	}
+
+	type match struct{ installed, available, repo, kind string }
+	var got []match
+	for _, m := range FindMigrated(local, sync) {
+		got = append(got, match{m.Installed.Name, m.Available.Name, m.Available.Repo, m.Match})
+	}
+	want := []match{
+		{"bar-git", "libbar", "extra", "provides"},
+		{"baz", "newbaz", "extra", "replaces"},
+		{"foo", "foo", "extra", "name"},
+		{"qux-bin", "qux", "extra", "replaces"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindMigrated() = %+v, want %+v", got, want)
+	}
+}
@@ -21,11 +21,13 @@ package libalpm
 
 /*
    #cgo pkg-config: libalpm
+   #include <stdlib.h>
    #include <alpm.h>
 */
 import "C"
 import (
 	"fmt"
+	"unsafe"
 )
 
 /*
@@ -73,7 +75,7 @@ func GetSyncPackages(root, dbPath string, repos []string) (pkgs map[string]strin
 
 		for pkg := pkgcache; pkg != nil; pkg = pkg.next {
 			name := C.GoString(C.alpm_pkg_get_name((*C.alpm_pkg_t)(pkg.data)))
-			version := C.GoString(C.alpm_pkg_get_name((*C.alpm_pkg_t)(pkg.data)))
+			version := C.GoString(C.alpm_pkg_get_version((*C.alpm_pkg_t)(pkg.data)))
 			pkgs[name] = version
 		}
 	}
@@ -88,3 +90,137 @@ The return value is negative when a is less than b, zero when a and b are equal,
 func CompareVersions(a, b string) int {
 	return int(C.alpm_pkg_vercmp(C.CString(a), C.CString(b)))
 }
+
+/*
+GetLocalPackageDetails retrieves the full details of every locally-installed package.
+Keys are package names.
+Unlike GetLocalPackages, the RequiredBy, OptionalFor and Signed fields of each package are computed.
+If an error is encountered it is returned in err.
+*/
+func GetLocalPackageDetails(root, dbPath string) (pkgs map[string]Package, err error) {
+	handle, err := initialize(root, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer C.alpm_release(handle)
+
+	pkgcache := C.alpm_db_get_pkgcache(C.alpm_get_localdb(handle))
+	pkgs = make(map[string]Package)
+	for pkg := pkgcache; pkg != nil; pkg = pkg.next {
+		p := newPackage((*C.alpm_pkg_t)(pkg.data))
+		p.RequiredBy = takeStrings(C.alpm_pkg_compute_requiredby((*C.alpm_pkg_t)(pkg.data)))
+		p.OptionalFor = takeStrings(C.alpm_pkg_compute_optionalfor((*C.alpm_pkg_t)(pkg.data)))
+		p.Signed = C.alpm_pkg_get_validation((*C.alpm_pkg_t)(pkg.data))&C.ALPM_PKG_VALIDATION_SIGNATURE != 0
+		pkgs[p.Name] = p
+	}
+
+	return
+}
+
+/*
+GetSyncPackageDetails retrieves the full details of every package available from the specified repos.
+Packages are returned in repository order, so a package available from several repos appears once per repo.
+If an error is encountered it is returned in err.
+*/
+func GetSyncPackageDetails(root, dbPath string, repos []string) (pkgs []Package, err error) {
+	handle, err := initialize(root, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer C.alpm_release(handle)
+
+	for _, repo := range repos {
+		syncDB, err := registerSyncDB(handle, repo)
+		if err != nil {
+			return nil, err
+		}
+		for pkg := C.alpm_db_get_pkgcache(syncDB); pkg != nil; pkg = pkg.next {
+			pkgs = append(pkgs, newPackage((*C.alpm_pkg_t)(pkg.data)))
+		}
+	}
+
+	return
+}
+
+/*
+initialize creates a new libalpm handle for the installation at root using the databases in dbPath.
+Callers are responsible for releasing the handle.
+*/
+func initialize(root, dbPath string) (handle *C.alpm_handle_t, err error) {
+	cRoot, cDBPath := C.CString(root), C.CString(dbPath)
+	defer C.free(unsafe.Pointer(cRoot))
+	defer C.free(unsafe.Pointer(cDBPath))
+
+	e := C.alpm_errno_t(0)
+	handle = C.alpm_initialize(cRoot, cDBPath, &e)
+	if e != C.ALPM_ERR_OK {
+		return nil, fmt.Errorf("failed to initialize alpm handle: %s", C.GoString(C.alpm_strerror(e)))
+	}
+
+	return
+}
+
+/*
+registerSyncDB registers the sync database for repo with handle.
+The databases are only read, so no signature verification is requested.
+*/
+func registerSyncDB(handle *C.alpm_handle_t, repo string) (db *C.alpm_db_t, err error) {
+	cRepo := C.CString(repo)
+	defer C.free(unsafe.Pointer(cRepo))
+
+	if db = C.alpm_register_syncdb(handle, cRepo, 0); db == nil {
+		return nil, fmt.Errorf("failed to register sync database '%s': %s", repo, C.GoString(C.alpm_strerror(C.alpm_errno(handle))))
+	}
+
+	return
+}
+
+// newPackage copies the details of pkg into a Package.
+func newPackage(pkg *C.alpm_pkg_t) Package {
+	return Package{
+		Name:          C.GoString(C.alpm_pkg_get_name(pkg)),
+		Version:       C.GoString(C.alpm_pkg_get_version(pkg)),
+		Description:   C.GoString(C.alpm_pkg_get_desc(pkg)),
+		Base:          C.GoString(C.alpm_pkg_get_base(pkg)),
+		Packager:      C.GoString(C.alpm_pkg_get_packager(pkg)),
+		Repo:          C.GoString(C.alpm_db_get_name(C.alpm_pkg_get_db(pkg))),
+		InstalledSize: int64(C.alpm_pkg_get_isize(pkg)),
+		Explicit:      C.alpm_pkg_get_reason(pkg) == C.ALPM_PKG_REASON_EXPLICIT,
+		Depends:       dependStrings(C.alpm_pkg_get_depends(pkg)),
+		OptDepends:    dependStrings(C.alpm_pkg_get_optdepends(pkg)),
+		MakeDepends:   dependStrings(C.alpm_pkg_get_makedepends(pkg)),
+		CheckDepends:  dependStrings(C.alpm_pkg_get_checkdepends(pkg)),
+		Provides:      dependStrings(C.alpm_pkg_get_provides(pkg)),
+		Replaces:      dependStrings(C.alpm_pkg_get_replaces(pkg)),
+		Groups:        goStrings(C.alpm_pkg_get_groups(pkg)),
+	}
+}
+
+// goStrings copies a list of C strings owned by libalpm.
+func goStrings(list *C.alpm_list_t) (s []string) {
+	for item := list; item != nil; item = item.next {
+		s = append(s, C.GoString((*C.char)(item.data)))
+	}
+
+	return
+}
+
+// takeStrings copies a list of C strings and frees the list and its contents.
+func takeStrings(list *C.alpm_list_t) (s []string) {
+	s = goStrings(list)
+	C.alpm_list_free_inner(list, (*[0]byte)(C.free))
+	C.alpm_list_free(list)
+
+	return
+}
+
+// dependStrings formats a list of alpm_depend_t as strings such as "name>=version".
+func dependStrings(list *C.alpm_list_t) (s []string) {
+	for item := list; item != nil; item = item.next {
+		dep := C.alpm_dep_compute_string((*C.alpm_depend_t)(item.data))
+		s = append(s, C.GoString(dep))
+		C.free(unsafe.Pointer(dep))
+	}
+
+	return
+}
@@ -0,0 +1,81 @@
+/*
+ * locale.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package locale formats dates for the user's locale, as pacman does.
+The locale is chosen by the C library from the LC_ALL, LC_TIME, or LANG environment variables, in that order.
+*/
+package locale
+
+/*
+#include <locale.h>
+#include <stdlib.h>
+#include <time.h>
+*/
+import "C"
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// the locale is read from the environment once, on first use
+var setup sync.Once
+
+/*
+Time formats t as the locale's date and time representation, the format pacman uses for dates.
+*/
+func Time(t time.Time) string {
+	return strftime("%c", t, time.DateTime)
+}
+
+/*
+Date formats t as the locale's date representation.
+*/
+func Date(t time.Time) string {
+	return strftime("%x", t, time.DateOnly)
+}
+
+/*
+strftime formats t in the local time zone using the C library's strftime and the given format.
+If the result is empty, fallback is used as a Go time layout instead.
+*/
+func strftime(format string, t time.Time, fallback string) string {
+	setup.Do(func() {
+		empty := C.CString("")
+		defer C.free(unsafe.Pointer(empty))
+		C.setlocale(C.LC_TIME, empty)
+		C.tzset()
+	})
+
+	var tm C.struct_tm
+	seconds := C.time_t(t.Unix())
+	if C.localtime_r(&seconds, &tm) == nil {
+		return t.Format(fallback)
+	}
+	cFormat := C.CString(format)
+	defer C.free(unsafe.Pointer(cFormat))
+	buf := make([]byte, 256)
+	n := C.strftime((*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)), cFormat, &tm)
+	if n == 0 {
+		return t.Format(fallback)
+	}
+
+	return string(buf[:n])
+}
@@ -0,0 +1,52 @@
+/*
+ * locale_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package locale
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// the locale and time zone are read once, so they are fixed before any test runs
+	os.Setenv("LC_ALL", "C")
+	os.Setenv("TZ", "UTC")
+	os.Exit(m.Run())
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		time string
+		date string
+	}{
+		{time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC), "Tue Mar  5 06:07:08 2024", "03/05/24"},
+		{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), "Tue Nov 10 23:00:00 2009", "11/10/09"},
+		{time.Unix(0, 0), "Thu Jan  1 00:00:00 1970", "01/01/70"},
+	}
+	for _, tt := range tests {
+		if got := Time(tt.t); got != tt.time {
+			t.Errorf("Time(%s) = %q, want %q", tt.t, got, tt.time)
+		}
+		if got := Date(tt.t); got != tt.date {
+			t.Errorf("Date(%s) = %q, want %q", tt.t, got, tt.date)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * pgp.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package pgp checks the user's GnuPG keyring for the keys packages trust, verifies
+detached signatures of sources, and imports keys, by running gpg.
+*/
+package pgp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the gpg command run for every operation
+const gpg = "gpg"
+
+/*
+NormalizeFingerprint returns the fingerprint or key ID s in upper case without spaces or a 0x prefix,
+the form gpg prints in its machine-readable output.
+*/
+func NormalizeFingerprint(s string) string {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+
+	return strings.TrimPrefix(s, "0X")
+}
+
+// matches reports whether the fingerprint fpr is the key named by the fingerprint or key ID key.
+func matches(fpr, key string) bool {
+	return key != "" && strings.HasSuffix(fpr, NormalizeFingerprint(key))
+}
+
+var escapePattern = regexp.MustCompile(`\\x[0-9a-fA-F]{2}`)
+
+// unescape decodes the \xHH escapes gpg uses in colon-delimited output.
+func unescape(s string) string {
+	return escapePattern.ReplaceAllStringFunc(s, func(e string) string {
+		b, _ := strconv.ParseUint(e[2:], 16, 8)
+		return string(rune(b))
+	})
+}
+
+/*
+A Key is a key listed by gpg.
+*/
+type Key struct {
+	Fingerprint string   // fingerprint of the primary key
+	Subkeys     []string // fingerprints of the subkeys
+	UserIDs     []string
+}
+
+/*
+parseKeys reads the keys in gpg's --with-colons listing.
+*/
+func parseKeys(r io.Reader) (keys []Key) {
+	var current *Key
+	inSubkey := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			keys = append(keys, Key{})
+			current, inSubkey = &keys[len(keys)-1], false
+		case "sub":
+			inSubkey = true
+		case "fpr":
+			switch {
+			case current == nil:
+			case inSubkey:
+				current.Subkeys = append(current.Subkeys, fields[9])
+			case current.Fingerprint == "":
+				current.Fingerprint = fields[9]
+			}
+		case "uid":
+			if current != nil {
+				current.UserIDs = append(current.UserIDs, unescape(fields[9]))
+			}
+		}
+	}
+
+	return
+}
+
+/*
+Has reports whether k is the key named by the fingerprint or key ID key, matching the primary key or any subkey.
+*/
+func (k Key) Has(key string) bool {
+	return matches(k.Fingerprint, key) || slices.ContainsFunc(k.Subkeys, func(s string) bool { return matches(s, key) })
+}
+
+/*
+run runs gpg with args and input on stdin, returning its standard output.
+A gpg that cannot be started is an error, but a non-zero exit status is not, since gpg uses it
+for partial results such as some keys being missing; the caller interprets the output.
+*/
+func run(input io.Reader, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	c := exec.Command(gpg, append([]string{"--batch", "--no-tty"}, args...)...)
+	c.Stdin, c.Stdout = input, &stdout
+	var exitErr *exec.ExitError
+	if err := c.Run(); err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run %s: %w", gpg, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+/*
+LocalKeys returns the keys in the user's keyring matching the fingerprints or key IDs in keys.
+*/
+func LocalKeys(keys []string) ([]Key, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	args := []string{"--with-colons", "--fixed-list-mode", "--with-fingerprint", "--with-subkey-fingerprint", "--list-keys", "--"}
+	for _, k := range keys {
+		args = append(args, NormalizeFingerprint(k))
+	}
+	output, err := run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKeys(bytes.NewReader(output)), nil
+}
+
+/*
+Missing returns the fingerprints or key IDs in keys with no matching key in the user's keyring.
+*/
+func Missing(keys []string) (missing []string, err error) {
+	local, err := LocalKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if !slices.ContainsFunc(local, func(l Key) bool { return l.Has(k) }) {
+			missing = append(missing, k)
+		}
+	}
+
+	return
+}
+
+// A Status is the outcome of verifying a signature.
+type Status string
+
+const (
+	Good       Status = "good"        // the signature is valid
+	Bad        Status = "bad"         // the data does not match the signature
+	Expired    Status = "expired"     // the signature or its key has expired
+	Revoked    Status = "revoked"     // the signing key has been revoked
+	MissingKey Status = "missing-key" // the signing key is not in the keyring
+	Error      Status = "error"       // the signature could not be checked
+)
+
+/*
+A Verification is the result of checking a detached signature.
+*/
+type Verification struct {
+	Status      Status
+	Fingerprint string // fingerprint of the signing key, or its key ID if the key is missing
+	Primary     string // fingerprint of the primary key of the signing key
+}
+
+/*
+SignedBy reports whether the signing key, or its primary key, is one of keys, as makepkg requires of validpgpkeys.
+*/
+func (v Verification) SignedBy(keys []string) bool {
+	return slices.ContainsFunc(keys, func(k string) bool {
+		return len(NormalizeFingerprint(k)) == 40 && (matches(v.Fingerprint, k) || matches(v.Primary, k))
+	})
+}
+
+/*
+parseStatus reads the outcome of a verification from gpg's --status-fd output.
+*/
+func parseStatus(r io.Reader) (v Verification) {
+	v.Status = Error
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(scanner.Text(), "[GNUPG:] "))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "VALIDSIG":
+			v.Fingerprint = fields[1]
+			if len(fields) > 10 {
+				v.Primary = fields[10]
+			}
+		case "GOODSIG":
+			v.Status = Good
+		case "BADSIG":
+			v.Status, v.Fingerprint = Bad, fields[1]
+		case "EXPSIG", "EXPKEYSIG":
+			v.Status = Expired
+		case "REVKEYSIG":
+			v.Status = Revoked
+		case "NO_PUBKEY":
+			v.Status, v.Fingerprint = MissingKey, fields[1]
+		}
+	}
+
+	return
+}
+
+/*
+Verify checks the detached signature in the file at signature against data, using the user's keyring.
+An error is only returned if gpg cannot be run; a signature gpg rejects has a Status other than Good.
+*/
+func Verify(signature string, data io.Reader) (Verification, error) {
+	output, err := run(data, "--status-fd", "1", "--verify", "--", signature, "-")
+	if err != nil {
+		return Verification{Status: Error}, err
+	}
+
+	return parseStatus(bytes.NewReader(output)), nil
+}
+
+/*
+ImportFile imports the keys named in keys from the keyring or exported key file at path, and no others.
+The file is read into a temporary keyring so unrelated keys it holds are not added to the user's keyring.
+*/
+func ImportFile(path string, keys []string) error {
+	home, err := os.MkdirTemp("", "pkg-gnupg-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary keyring: %w", err)
+	}
+	defer os.RemoveAll(home)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err = run(f, "--homedir", home, "--import"); err != nil {
+		return err
+	}
+	output, err := run(nil, "--homedir", home, "--with-colons", "--fixed-list-mode", "--with-subkey-fingerprint", "--list-keys")
+	if err != nil {
+		return err
+	}
+
+	var wanted []string
+	for _, k := range parseKeys(bytes.NewReader(output)) {
+		if slices.ContainsFunc(keys, k.Has) {
+			wanted = append(wanted, k.Fingerprint)
+		}
+	}
+	if len(wanted) == 0 {
+		return fmt.Errorf("none of the keys are in %s", path)
+	}
+	exported, err := run(nil, append([]string{"--homedir", home, "--export", "--"}, wanted...)...)
+	if err != nil {
+		return err
+	}
+	if _, err = run(bytes.NewReader(exported), "--import"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+Receive imports the keys named by the fingerprints in keys from the keyserver at url, such as hkps://keys.openpgp.org.
+*/
+func Receive(url string, keys []string) error {
+	args := []string{"--keyserver", url, "--recv-keys", "--"}
+	for _, k := range keys {
+		args = append(args, NormalizeFingerprint(k))
+	}
+	c := exec.Command(gpg, append([]string{"--batch", "--no-tty"}, args...)...)
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to receive keys from %s: %w", url, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+ * pgp_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package pgp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fingerprints of a captured key with a certification-only primary key and a signing subkey
+const (
+	primaryFingerprint = "5B79493D2CFDDF1E780315799A90265DEE172AA1"
+	subkeyFingerprint  = "4857F5F244D92557EDD993A1FBFE97865DC97CBC"
+	otherFingerprint   = "0123456789ABCDEF0123456789ABCDEF01234567"
+)
+
+// captured from gpg --with-colons --fixed-list-mode --with-fingerprint --with-subkey-fingerprint --list-keys
+const listing = `tru::1:1792434282:1855506282:3:1:5
+pub:u:255:22:9A90265DEE172AA1:1792434282:1855506282::u:::cSC:::::ed25519:::0:
+fpr:::::::::5B79493D2CFDDF1E780315799A90265DEE172AA1:
+uid:u::::1792434282::F57D7EE29A4C43092547C21E8A380E210FCBCE57::Test Signer <signer@example.org>::::::::::0:
+uid:u::::1792434282::A57D7EE29A4C43092547C21E8A380E210FCBCE57::Signer\x3a Work <work@example.org>::::::::::0:
+sub:u:255:22:FBFE97865DC97CBC:1792434282::::::s:::::ed25519::
+fpr:::::::::4857F5F244D92557EDD993A1FBFE97865DC97CBC:
+pub:-:4096:1:0123456789ABCDEF01234567:1600000000:::-:::scESC::::::23::0:
+fpr:::::::::0123456789ABCDEF0123456789ABCDEF01234567:
+uid:-::::1600000000::B57D7EE29A4C43092547C21E8A380E210FCBCE57::Other Person <other@example.org>::::::::::0:
+`
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys(strings.NewReader(listing))
+	if len(keys) != 2 {
+		t.Fatalf("parseKeys found %d keys, want 2", len(keys))
+	}
+	signer := keys[0]
+	if signer.Fingerprint != primaryFingerprint || !slices.Equal(signer.Subkeys, []string{subkeyFingerprint}) {
+		t.Errorf("first key = %+v, want primary %s with subkey %s", signer, primaryFingerprint, subkeyFingerprint)
+	}
+	if want := []string{"Test Signer <signer@example.org>", "Signer: Work <work@example.org>"}; !slices.Equal(signer.UserIDs, want) {
+		t.Errorf("first key user IDs = %q, want %q", signer.UserIDs, want)
+	}
+	if other := keys[1]; other.Fingerprint != otherFingerprint || len(other.Subkeys) != 0 {
+		t.Errorf("second key = %+v, want %s without subkeys", other, otherFingerprint)
+	}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{primaryFingerprint, true},
+		{subkeyFingerprint, true},
+		{strings.ToLower(primaryFingerprint), true},
+		{"5B79 493D 2CFD DF1E 7803  1579 9A90 265D EE17 2AA1", true},
+		{"0x9A90265DEE172AA1", true},
+		{"FBFE97865DC97CBC", true},
+		{otherFingerprint, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := signer.Has(tt.key); got != tt.want {
+			t.Errorf("Has(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	tests := map[string]string{
+		primaryFingerprint:                                   primaryFingerprint,
+		"5b79493d2cfddf1e780315799a90265dee172aa1":           primaryFingerprint,
+		"5B79 493D 2CFD DF1E 7803  1579 9A90 265D EE17 2AA1": primaryFingerprint,
+		"0x9a90265dee172aa1":                                 "9A90265DEE172AA1",
+		"0X9A90265DEE172AA1":                                 "9A90265DEE172AA1",
+	}
+	for in, want := range tests {
+		if got := NormalizeFingerprint(in); got != want {
+			t.Errorf("NormalizeFingerprint(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Verification
+	}{
+		// a good signature made by the signing subkey
+		{"good", `[GNUPG:] NEWSIG
+[GNUPG:] KEY_CONSIDERED 5B79493D2CFDDF1E780315799A90265DEE172AA1 0
+[GNUPG:] SIG_ID i07mA6Uztxqa8ay8ZMpt1UtBhVU 2026-10-19 1792434282
+[GNUPG:] GOODSIG FBFE97865DC97CBC Test Signer <signer@example.org>
+[GNUPG:] VALIDSIG 4857F5F244D92557EDD993A1FBFE97865DC97CBC 2026-10-19 1792434282 0 4 0 22 8 00 5B79493D2CFDDF1E780315799A90265DEE172AA1
+[GNUPG:] TRUST_ULTIMATE 0 pgp
+`, Verification{Good, subkeyFingerprint, primaryFingerprint}},
+		{"bad", `[GNUPG:] NEWSIG
+[GNUPG:] KEY_CONSIDERED 5B79493D2CFDDF1E780315799A90265DEE172AA1 0
+[GNUPG:] BADSIG FBFE97865DC97CBC Test Signer <signer@example.org>
+[GNUPG:] FAILURE gpg-exit 33554433
+`, Verification{Bad, "FBFE97865DC97CBC", ""}},
+		{"expired key", `[GNUPG:] NEWSIG
+[GNUPG:] KEYEXPIRED 1700000000
+[GNUPG:] EXPKEYSIG FBFE97865DC97CBC Test Signer <signer@example.org>
+[GNUPG:] VALIDSIG 4857F5F244D92557EDD993A1FBFE97865DC97CBC 2023-11-01 1698800000 0 4 0 22 8 00 5B79493D2CFDDF1E780315799A90265DEE172AA1
+`, Verification{Expired, subkeyFingerprint, primaryFingerprint}},
+		{"revoked key", `[GNUPG:] NEWSIG
+[GNUPG:] REVKEYSIG FBFE97865DC97CBC Test Signer <signer@example.org>
+[GNUPG:] VALIDSIG 4857F5F244D92557EDD993A1FBFE97865DC97CBC 2026-10-19 1792434282 0 4 0 22 8 00 5B79493D2CFDDF1E780315799A90265DEE172AA1
+`, Verification{Revoked, subkeyFingerprint, primaryFingerprint}},
+		{"missing key", `[GNUPG:] NEWSIG
+[GNUPG:] ERRSIG FBFE97865DC97CBC 22 8 00 1792434282 9 4857F5F244D92557EDD993A1FBFE97865DC97CBC
+[GNUPG:] NO_PUBKEY FBFE97865DC97CBC
+`, Verification{MissingKey, "FBFE97865DC97CBC", ""}},
+		{"no signature", "[GNUPG:] NODATA 1\n[GNUPG:] FAILURE gpg-exit 33554433\n", Verification{Status: Error}},
+		{"empty", "", Verification{Status: Error}},
+	}
+	for _, tt := range tests {
+		if got := parseStatus(strings.NewReader(tt.output)); got != tt.want {
+			t.Errorf("%s: parseStatus = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSignedBy(t *testing.T) {
+	v := Verification{Good, subkeyFingerprint, primaryFingerprint}
+	tests := []struct {
+		keys []string
+		want bool
+	}{
+		{[]string{primaryFingerprint}, true},
+		{[]string{subkeyFingerprint}, true},
+		{[]string{otherFingerprint, strings.ToLower(primaryFingerprint)}, true},
+		{[]string{"5B79 493D 2CFD DF1E 7803  1579 9A90 265D EE17 2AA1"}, true},
+		// makepkg requires full fingerprints, so key IDs never match
+		{[]string{"9A90265DEE172AA1"}, false},
+		{[]string{"0xFBFE97865DC97CBC"}, false},
+		{[]string{"EE172AA1"}, false},
+		{[]string{otherFingerprint}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := v.SignedBy(tt.keys); got != tt.want {
+			t.Errorf("SignedBy(%q) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+
+	// a missing key is only known by its key ID, which cannot match
+	missing := Verification{MissingKey, "FBFE97865DC97CBC", ""}
+	if missing.SignedBy([]string{subkeyFingerprint}) {
+		t.Error("SignedBy matched a key ID from NO_PUBKEY against a full fingerprint")
+	}
+}
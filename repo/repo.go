@@ -0,0 +1,558 @@
+/*
+ * repo.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package repo maintains pacman repository databases, in the format written by repo-add.
+*/
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmoller/pkg/archive"
+	"github.com/bmoller/pkg/libalpm"
+)
+
+// suffixes of the database files, and of the links pacman reads them through
+const (
+	dbSuffix        = ".db.tar.gz"
+	filesSuffix     = ".files.tar.gz"
+	dbLinkSuffix    = ".db"
+	filesLinkSuffix = ".files"
+	sigSuffix       = ".sig"
+)
+
+/*
+An Entry describes one package in a repository database.
+The fields correspond to those of the database's desc and files entries.
+*/
+type Entry struct {
+	Filename       string
+	Name           string
+	Base           string
+	Version        string
+	Description    string
+	Groups         []string
+	CompressedSize int64
+	InstalledSize  int64
+	SHA256Sum      string
+	PGPSig         string // base64-encoded detached signature of the package file
+	URL            string
+	License        []string
+	Arch           string
+	BuildDate      int64 // Unix timestamp
+	Packager       string
+	Replaces       []string
+	Conflicts      []string
+	Provides       []string
+	Depends        []string
+	OptDepends     []string
+	MakeDepends    []string
+	CheckDepends   []string
+	Files          []string `json:"-"` // paths installed by the package, only in the files database
+}
+
+/*
+NewEntry builds the database entry for the package file at path, including a signature at path.sig if present.
+*/
+func NewEntry(path string) (*Entry, error) {
+	pkg, err := archive.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package file: %w", err)
+	}
+	defer f.Close()
+	sum := sha256.New()
+	size, err := io.Copy(sum, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package file: %w", err)
+	}
+
+	info := pkg.Info
+	e := &Entry{
+		Filename:       filepath.Base(path),
+		Name:           info.Name,
+		Base:           info.Base,
+		Version:        info.Version,
+		Description:    info.Description,
+		Groups:         info.Groups,
+		CompressedSize: size,
+		InstalledSize:  info.Size,
+		SHA256Sum:      hex.EncodeToString(sum.Sum(nil)),
+		URL:            info.URL,
+		License:        info.License,
+		Arch:           info.Arch,
+		BuildDate:      info.BuildDate,
+		Packager:       info.Packager,
+		Replaces:       info.Replaces,
+		Conflicts:      info.Conflicts,
+		Provides:       info.Provides,
+		Depends:        info.Depends,
+		OptDepends:     info.OptDepends,
+		MakeDepends:    info.MakeDepends,
+		CheckDepends:   info.CheckDepends,
+	}
+	for _, entry := range pkg.Entries {
+		e.Files = append(e.Files, entry.Path)
+	}
+	slices.Sort(e.Files)
+	if sig, err := os.ReadFile(path + sigSuffix); err == nil {
+		e.PGPSig = base64.StdEncoding.EncodeToString(sig)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read package signature: %w", err)
+	}
+
+	return e, nil
+}
+
+// dirName is the name of the directory holding the entry in the database archives.
+func (e *Entry) dirName() string {
+	return e.Name + "-" + e.Version
+}
+
+// desc builds the contents of the entry's desc file.
+func (e *Entry) desc() []byte {
+	var b bytes.Buffer
+	field := func(key string, values ...string) {
+		values = slices.DeleteFunc(values, func(v string) bool { return v == "" })
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%%%s%%\n%s\n\n", key, strings.Join(values, "\n"))
+	}
+	field("FILENAME", e.Filename)
+	field("NAME", e.Name)
+	field("BASE", e.Base)
+	field("VERSION", e.Version)
+	field("DESC", e.Description)
+	field("GROUPS", e.Groups...)
+	field("CSIZE", strconv.FormatInt(e.CompressedSize, 10))
+	field("ISIZE", strconv.FormatInt(e.InstalledSize, 10))
+	field("SHA256SUM", e.SHA256Sum)
+	field("PGPSIG", e.PGPSig)
+	field("URL", e.URL)
+	field("LICENSE", e.License...)
+	field("ARCH", e.Arch)
+	field("BUILDDATE", strconv.FormatInt(e.BuildDate, 10))
+	field("PACKAGER", e.Packager)
+	field("REPLACES", e.Replaces...)
+	field("CONFLICTS", e.Conflicts...)
+	field("PROVIDES", e.Provides...)
+	field("DEPENDS", e.Depends...)
+	field("OPTDEPENDS", e.OptDepends...)
+	field("MAKEDEPENDS", e.MakeDepends...)
+	field("CHECKDEPENDS", e.CheckDepends...)
+
+	return b.Bytes()
+}
+
+// files builds the contents of the entry's files file.
+func (e *Entry) files() []byte {
+	return []byte("%FILES%\n" + strings.Join(e.Files, "\n") + "\n")
+}
+
+/*
+parseFields reads the %KEY% sections of a desc or files file.
+*/
+func parseFields(contents []byte) map[string][]string {
+	fields := make(map[string][]string)
+	key := ""
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		switch line := scanner.Text(); {
+		case line == "":
+			key = ""
+		case key == "" && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%"):
+			key = strings.Trim(line, "%")
+			fields[key] = []string{}
+		case key != "":
+			fields[key] = append(fields[key], line)
+		}
+	}
+
+	return fields
+}
+
+// setFields fills the entry from the fields of its desc or files file.
+func (e *Entry) setFields(fields map[string][]string) {
+	first := func(key string) string {
+		if v := fields[key]; len(v) != 0 {
+			return v[0]
+		}
+		return ""
+	}
+	number := func(key string) int64 {
+		i, _ := strconv.ParseInt(first(key), 10, 64)
+		return i
+	}
+	for key, values := range fields {
+		switch key {
+		case "FILENAME":
+			e.Filename = first(key)
+		case "NAME":
+			e.Name = first(key)
+		case "BASE":
+			e.Base = first(key)
+		case "VERSION":
+			e.Version = first(key)
+		case "DESC":
+			e.Description = first(key)
+		case "GROUPS":
+			e.Groups = values
+		case "CSIZE":
+			e.CompressedSize = number(key)
+		case "ISIZE":
+			e.InstalledSize = number(key)
+		case "SHA256SUM":
+			e.SHA256Sum = first(key)
+		case "PGPSIG":
+			e.PGPSig = first(key)
+		case "URL":
+			e.URL = first(key)
+		case "LICENSE":
+			e.License = values
+		case "ARCH":
+			e.Arch = first(key)
+		case "BUILDDATE":
+			e.BuildDate = number(key)
+		case "PACKAGER":
+			e.Packager = first(key)
+		case "REPLACES":
+			e.Replaces = values
+		case "CONFLICTS":
+			e.Conflicts = values
+		case "PROVIDES":
+			e.Provides = values
+		case "DEPENDS":
+			e.Depends = values
+		case "OPTDEPENDS":
+			e.OptDepends = values
+		case "MAKEDEPENDS":
+			e.MakeDepends = values
+		case "CHECKDEPENDS":
+			e.CheckDepends = values
+		case "FILES":
+			e.Files = values
+		}
+	}
+}
+
+/*
+A Repo is a pacman repository: a directory of package files and the databases describing them.
+*/
+type Repo struct {
+	Name    string            // repository name, as used for its section in pacman.conf
+	Dir     string            // directory holding the databases and package files
+	Entries map[string]*Entry // entries keyed by package name
+}
+
+/*
+Open loads the repository whose database is at path, such as /srv/repo/ourrepo.db.tar.gz.
+The path may also name the .db link or the .files database.
+A repository without databases yet is empty.
+*/
+func Open(path string) (*Repo, error) {
+	name := filepath.Base(path)
+	for _, suffix := range []string{dbSuffix, filesSuffix, dbLinkSuffix, filesLinkSuffix} {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+			name = trimmed
+			break
+		}
+	}
+	r := &Repo{Name: name, Dir: filepath.Dir(path), Entries: make(map[string]*Entry)}
+
+	// the files database holds the desc entries as well as the file lists
+	for _, db := range []string{r.filesPath(), r.dbPath()} {
+		switch err := r.load(db); {
+		case err == nil:
+			return r, nil
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// dbPath is the path of the repository's package database.
+func (r *Repo) dbPath() string {
+	return filepath.Join(r.Dir, r.Name+dbSuffix)
+}
+
+// filesPath is the path of the repository's files database.
+func (r *Repo) filesPath() string {
+	return filepath.Join(r.Dir, r.Name+filesSuffix)
+}
+
+// load reads the entries of the database archive at path.
+func (r *Repo) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d, err := archive.Decompress(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer d.Close()
+
+	entries := make(map[string]*Entry)
+	tarReader := tar.NewReader(d)
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read database %s: %w", path, err)
+		}
+		dir, file := filepath.Split(h.Name)
+		if h.Typeflag != tar.TypeReg || (file != "desc" && file != "files") {
+			continue
+		}
+		contents, err := io.ReadAll(tarReader)
+		if err != nil {
+			return fmt.Errorf("failed to read database %s: %w", path, err)
+		}
+		e, ok := entries[dir]
+		if !ok {
+			e = new(Entry)
+			entries[dir] = e
+		}
+		e.setFields(parseFields(contents))
+	}
+
+	for _, e := range entries {
+		if e.Name == "" {
+			return fmt.Errorf("database %s has an entry without a name", path)
+		}
+		r.Entries[e.Name] = e
+	}
+
+	return nil
+}
+
+/*
+Add adds the package file at path to the repository, replacing any entry for a package of the same name.
+The new entry is returned in added and the replaced entry, if any, in old.
+If the replaced entry's version is newer than the added package's, the repository is unchanged and err is set.
+With prune set, the replaced entry's package file and signature are deleted from the repository directory.
+*/
+func (r *Repo) Add(path string, prune bool) (added, old *Entry, err error) {
+	added, err = NewEntry(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	old = r.Entries[added.Name]
+	if old != nil && libalpm.CompareVersions(old.Version, added.Version) > 0 {
+		return nil, old, fmt.Errorf("a newer version of %s (%s) is already in the repository", added.Name, old.Version)
+	}
+	r.Entries[added.Name] = added
+	if prune && old != nil && old.Filename != added.Filename {
+		err = r.deleteFile(old.Filename)
+	}
+
+	return
+}
+
+/*
+Remove removes the package name from the repository, returning its entry.
+With prune set, the package file and signature are deleted from the repository directory.
+*/
+func (r *Repo) Remove(name string, prune bool) (old *Entry, err error) {
+	old, ok := r.Entries[name]
+	if !ok {
+		return nil, fmt.Errorf("package %s is not in the repository", name)
+	}
+	delete(r.Entries, name)
+	if prune {
+		err = r.deleteFile(old.Filename)
+	}
+
+	return
+}
+
+// deleteFile removes a package file and its signature from the repository directory, if they exist.
+func (r *Repo) deleteFile(filename string) error {
+	for _, name := range []string{filename, filename + sigSuffix} {
+		if err := os.Remove(filepath.Join(r.Dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+List returns the repository's entries ordered by name.
+*/
+func (r *Repo) List() (entries []Entry) {
+	for _, name := range slices.Sorted(maps.Keys(r.Entries)) {
+		entries = append(entries, *r.Entries[name])
+	}
+
+	return
+}
+
+/*
+Save writes the package and files databases and links the names pacman reads, name.db and name.files, to them.
+The databases are replaced atomically, so pacman never reads a partially written database.
+*/
+func (r *Repo) Save() error {
+	if err := r.write(r.dbPath(), false); err != nil {
+		return err
+	}
+	if err := r.write(r.filesPath(), true); err != nil {
+		return err
+	}
+	for link, target := range map[string]string{
+		r.Name + dbLinkSuffix:    r.Name + dbSuffix,
+		r.Name + filesLinkSuffix: r.Name + filesSuffix,
+	} {
+		path := filepath.Join(r.Dir, link)
+		if current, err := os.Readlink(path); err == nil && current == target {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace %s: %w", link, err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			return fmt.Errorf("failed to link %s: %w", link, err)
+		}
+	}
+
+	return nil
+}
+
+// write writes the database archive at path, including file lists if files is set.
+func (r *Repo) write(path string, files bool) error {
+	tmp, err := os.CreateTemp(r.Dir, filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	tarWriter := tar.NewWriter(gz)
+	now := time.Now()
+	add := func(name string, contents []byte) error {
+		h := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), ModTime: now, Typeflag: tar.TypeReg}
+		if contents == nil {
+			h.Mode, h.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tarWriter.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err := tarWriter.Write(contents)
+		return err
+	}
+	for _, e := range r.List() {
+		dir := e.dirName() + "/"
+		if err = add(dir, nil); err == nil {
+			err = add(dir+"desc", e.desc())
+		}
+		if err == nil && files {
+			err = add(dir+"files", e.files())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write database %s: %w", path, err)
+		}
+	}
+	if err = tarWriter.Close(); err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write database %s: %w", path, err)
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write database %s: %w", path, err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace database %s: %w", path, err)
+	}
+
+	return nil
+}
+
+/*
+Sign creates detached signatures of both databases with gpg, using key or gpg's default key if key is empty.
+The signature links name.db.sig and name.files.sig are created alongside the databases' links.
+*/
+func (r *Repo) Sign(key string) error {
+	for _, db := range []string{r.Name + dbSuffix, r.Name + filesSuffix} {
+		path := filepath.Join(r.Dir, db)
+		args := []string{"--batch", "--yes", "--detach-sign", "--no-armor", "--output", path + sigSuffix}
+		if key != "" {
+			args = append(args, "--local-user", key)
+		}
+		c := exec.Command("gpg", append(args, path)...)
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("failed to sign %s: %w", db, err)
+		}
+
+		link := filepath.Join(r.Dir, strings.TrimSuffix(db, ".tar.gz")+sigSuffix)
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace %s: %w", filepath.Base(link), err)
+		}
+		if err := os.Symlink(db+sigSuffix, link); err != nil {
+			return fmt.Errorf("failed to link %s: %w", filepath.Base(link), err)
+		}
+	}
+
+	return nil
+}
+
+/*
+RemoveSignatures deletes the signatures of both databases, which become invalid when the databases change.
+*/
+func (r *Repo) RemoveSignatures() error {
+	for _, db := range []string{r.Name + dbSuffix, r.Name + filesSuffix} {
+		for _, name := range []string{db + sigSuffix, strings.TrimSuffix(db, ".tar.gz") + sigSuffix} {
+			if err := os.Remove(filepath.Join(r.Dir, name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+ * repo_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package repo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writePackage writes a gzip-compressed package file for name at version to dir, returning its path.
+func writePackage(t *testing.T, dir, name, version string) string {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-x86_64.pkg.tar.gz", name, version))
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gz)
+	pkginfo := fmt.Sprintf("pkgname = %s\npkgver = %s\npkgdesc = test package\narch = x86_64\nsize = 42\nbuilddate = 1700000000\ndepend = glibc\n", name, version)
+	for _, file := range []struct {
+		name     string
+		contents string
+	}{{".PKGINFO", pkginfo}, {"usr/bin/" + name, "#!/bin/sh\n"}, {"usr/share/doc/" + name + "/README", version}} {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(file.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// exists reports whether the file at path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// reopen saves r and opens it again from disk.
+func reopen(t *testing.T, r *Repo) *Repo {
+	t.Helper()
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(filepath.Join(r.Dir, r.Name+dbLinkSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+func TestRepo(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(filepath.Join(dir, "test"+dbSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "test" || len(r.Entries) != 0 {
+		t.Fatalf("Open of a new repository = %q with %d entries, want test with none", r.Name, len(r.Entries))
+	}
+
+	// add
+	first := writePackage(t, dir, "foo", "1.0-1")
+	signature := []byte("signature")
+	if err := os.WriteFile(first+sigSuffix, signature, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writePackage(t, dir, "bar", "2.0-1")
+	for _, path := range []string{first, filepath.Join(dir, "bar-2.0-1-x86_64.pkg.tar.gz")} {
+		if _, old, err := r.Add(path, true); err != nil || old != nil {
+			t.Fatalf("Add(%s) old = %v, err = %v; want no old entry and no error", path, old, err)
+		}
+	}
+	r = reopen(t, r)
+	for _, link := range []string{"test" + dbLinkSuffix, "test" + filesLinkSuffix} {
+		if target, err := os.Readlink(filepath.Join(dir, link)); err != nil || !exists(filepath.Join(dir, target)) {
+			t.Errorf("%s links to %q (%v), want an existing database", link, target, err)
+		}
+	}
+	if names := []string{r.List()[0].Name, r.List()[1].Name}; !slices.Equal(names, []string{"bar", "foo"}) {
+		t.Errorf("List() names = %q, want [bar foo]", names)
+	}
+	foo := r.Entries["foo"]
+	if foo == nil {
+		t.Fatal("foo not in the reopened repository")
+	}
+	stat, err := os.Stat(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.Filename != filepath.Base(first) || foo.Version != "1.0-1" || foo.Base != "foo" || foo.Description != "test package" ||
+		foo.InstalledSize != 42 || foo.BuildDate != 1700000000 || foo.CompressedSize != stat.Size() || len(foo.SHA256Sum) != 64 ||
+		!slices.Equal(foo.Depends, []string{"glibc"}) {
+		t.Errorf("reopened foo = %+v", *foo)
+	}
+	if want := base64.StdEncoding.EncodeToString(signature); foo.PGPSig != want {
+		t.Errorf("foo PGPSig = %q, want %q", foo.PGPSig, want)
+	}
+	if want := []string{"usr/bin/foo", "usr/share/doc/foo/README"}; !slices.Equal(foo.Files, want) {
+		t.Errorf("foo Files = %q, want %q", foo.Files, want)
+	}
+
+	// replace with a newer version, pruning the old package file and its signature
+	newer := writePackage(t, dir, "foo", "1.1-1")
+	added, old, err := r.Add(newer, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Version != "1.1-1" || old == nil || old.Version != "1.0-1" {
+		t.Errorf("Add(%s) = %v, %v; want 1.1-1 replacing 1.0-1", newer, added, old)
+	}
+	if exists(first) || exists(first+sigSuffix) {
+		t.Errorf("pruned package %s or its signature still exists", first)
+	}
+	r = reopen(t, r)
+	if v := r.Entries["foo"].Version; v != "1.1-1" {
+		t.Errorf("reopened foo version = %s, want 1.1-1", v)
+	}
+
+	// an older version is rejected and leaves the repository unchanged
+	older := writePackage(t, dir, "foo", "0.9-1")
+	if _, old, err := r.Add(older, true); err == nil || old == nil || old.Version != "1.1-1" {
+		t.Errorf("Add(%s) old = %v, err = %v; want 1.1-1 and an error", older, old, err)
+	}
+	if v := r.Entries["foo"].Version; v != "1.1-1" || !exists(newer) {
+		t.Errorf("after rejecting an older version foo is %s and %s exists = %v, want 1.1-1 kept", v, newer, exists(newer))
+	}
+
+	// without pruning, the replaced package file is kept
+	newest := writePackage(t, dir, "foo", "1.2-1")
+	if _, _, err := r.Add(newest, false); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(newer) {
+		t.Errorf("%s removed without pruning", newer)
+	}
+
+	// remove
+	if _, err := r.Remove("bar", true); err != nil {
+		t.Fatal(err)
+	}
+	if exists(filepath.Join(dir, "bar-2.0-1-x86_64.pkg.tar.gz")) {
+		t.Error("pruned package bar still exists")
+	}
+	if _, err := r.Remove("bar", true); err == nil {
+		t.Error("removing a package not in the repository succeeded")
+	}
+	r = reopen(t, r)
+	if len(r.Entries) != 1 || r.Entries["foo"] == nil || r.Entries["foo"].Version != "1.2-1" {
+		t.Errorf("reopened repository = %v, want only foo 1.2-1", r.List())
+	}
+}
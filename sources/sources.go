@@ -0,0 +1,365 @@
+/*
+ * sources.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package sources downloads the sources of packages and verifies them against their declared checksums.
+*/
+package sources
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/bmoller/pkg/srcinfo"
+	"github.com/bmoller/pkg/vcs"
+)
+
+// A Status is the outcome of fetching and verifying a source.
+type Status string
+
+const (
+	Verified Status = "verified" // every supported declared checksum matched
+	Mismatch Status = "mismatch" // a declared checksum did not match
+	Skipped  Status = "skipped"  // no checksum is declared besides SKIP, so the source was retrieved but not verified
+	Failed   Status = "failed"   // the source could not be retrieved
+	VCS      Status = "vcs"      // the source is a version control repository, which is not downloaded
+)
+
+// constructors of the hashes for each checksum algorithm makepkg supports, except the legacy ck
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+	"b2":     func() hash.Hash { h, _ := blake2b.New512(nil); return h },
+}
+
+// algorithms in order of preference for cache keys, strongest first
+var keyAlgorithms = []string{"b2", "sha512", "sha384", "sha256", "sha224", "sha1", "md5"}
+
+/*
+A Result is the outcome of fetching and verifying one source.
+*/
+type Result struct {
+	Entry      string // the source array entry
+	Name       string // file name the source is saved as
+	Path       string // location of the downloaded file, if any
+	Status     Status
+	Cached     bool     // the file was already in the cache
+	Mismatches []string // each failed check, as "algorithm: expected X, got Y"
+	Error      string
+}
+
+/*
+A Cache downloads sources into a directory shared between packages.
+Verified downloads are stored under the name and strongest checksum of the source,
+so a source declared with the same checksum by several packages is downloaded once.
+Unverified downloads are stored under the name and a hash of the URL of the source.
+*/
+type Cache struct {
+	Dir    string       // directory holding the downloads
+	Client *http.Client // client used for downloads; http.DefaultClient if nil
+}
+
+/*
+key returns the cache directory name for a source, from its strongest declared checksum.
+ok is false if every checksum is SKIP.
+*/
+func key(checksums map[string]string) (key string, ok bool) {
+	for _, algorithm := range keyAlgorithms {
+		if sum := checksums[algorithm]; sum != "" && sum != "SKIP" {
+			return algorithm + "-" + sum, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+path returns where the remote source s is saved in the cache, and whether it can be verified.
+ok is false for VCS sources and files bundled with a package, which are not saved,
+and for sources whose file name or checksum would place the file outside the cache directory.
+*/
+func (c *Cache) path(s srcinfo.Source) (path string, verifiable, ok bool) {
+	source := vcs.ParseSource(s.Entry)
+	if source.VCS != "" || !strings.Contains(source.URL, "://") || !safeName(source.Name) {
+		return "", false, false
+	}
+
+	k, verifiable := key(s.Checksums)
+	if !verifiable {
+		sum := sha256.Sum256([]byte(source.URL))
+		k = filepath.Join("unverified", hex.EncodeToString(sum[:]))
+	} else if !safeName(k) {
+		return "", false, false
+	}
+
+	// names come from .SRCINFO files, so the result is checked against the cache again
+	path = filepath.Join(c.Dir, k, source.Name)
+	if rel, err := filepath.Rel(c.Dir, path); err != nil || !filepath.IsLocal(rel) {
+		return "", false, false
+	}
+
+	return path, verifiable, true
+}
+
+// safeName reports whether name can be used as a single path element.
+func safeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+/*
+verify compares the digests computed for a source with its declared checksums.
+Checksums that are SKIP, and algorithms without a hash, are ignored.
+*/
+func verify(checksums map[string]string, digests map[string]hash.Hash) (mismatches []string) {
+	for _, algorithm := range slices.Sorted(maps.Keys(checksums)) {
+		expected, h := checksums[algorithm], digests[algorithm]
+		if expected == "SKIP" || h == nil {
+			continue
+		}
+		if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, got %s", algorithm, expected, actual))
+		}
+	}
+
+	return
+}
+
+/*
+digest copies r to w, returning the digests of the contents for each declared checksum algorithm.
+*/
+func digest(w io.Writer, r io.Reader, checksums map[string]string) (map[string]hash.Hash, error) {
+	digests := make(map[string]hash.Hash)
+	writers := []io.Writer{w}
+	for algorithm := range checksums {
+		if h, ok := hashes[algorithm]; ok {
+			digests[algorithm] = h()
+			writers = append(writers, digests[algorithm])
+		}
+	}
+	_, err := io.Copy(io.MultiWriter(writers...), r)
+
+	return digests, err
+}
+
+/*
+Get retrieves and verifies the source s.
+Remote sources are downloaded into the cache unless a verified copy is already there;
+sources with only SKIP checksums are downloaded again every time.
+Files bundled with the package are read using open, which may be nil to leave them unverified.
+*/
+func (c *Cache) Get(s srcinfo.Source, open func(name string) (io.ReadCloser, error)) (r Result) {
+	source := vcs.ParseSource(s.Entry)
+	r = Result{Entry: s.Entry, Name: source.Name}
+	if source.VCS != "" {
+		r.Status = VCS
+		return
+	}
+
+	if !strings.Contains(source.URL, "://") {
+		if open == nil {
+			r.Status, r.Error = Failed, "bundled file cannot be read"
+			return
+		}
+		f, err := open(source.URL)
+		if err != nil {
+			r.Status, r.Error = Failed, err.Error()
+			return
+		}
+		defer f.Close()
+		digests, err := digest(io.Discard, f, s.Checksums)
+		if err != nil {
+			r.Status, r.Error = Failed, err.Error()
+			return
+		}
+		return withStatus(r, s.Checksums, digests)
+	}
+
+	path, verifiable, ok := c.path(s)
+	if !ok {
+		r.Status, r.Error = Failed, fmt.Sprintf("refusing to save '%s' outside the cache", source.Name)
+		return
+	}
+	r.Path = path
+
+	// a cached file is checked again in case it was modified, and only reused if it
+	// still matches the checksum it is stored under; other checksums may still fail
+	if f, err := os.Open(r.Path); err == nil && verifiable {
+		digests, err := digest(io.Discard, f, s.Checksums)
+		f.Close()
+		k, _ := key(s.Checksums)
+		algorithm, _, _ := strings.Cut(k, "-")
+		if err == nil && len(verify(map[string]string{algorithm: s.Checksums[algorithm]}, digests)) == 0 {
+			r.Cached = true
+			if r = withStatus(r, s.Checksums, digests); r.Status == Mismatch {
+				r.Path = ""
+			}
+			return
+		}
+	}
+
+	digests, err := c.download(source.URL, r.Path, s.Checksums)
+	if err != nil {
+		r.Status, r.Error, r.Path = Failed, err.Error(), ""
+		return
+	}
+	r = withStatus(r, s.Checksums, digests)
+	if r.Status == Mismatch {
+		os.Remove(r.Path)
+		r.Path = ""
+	}
+
+	return
+}
+
+// withStatus sets the status of r from the digests computed for the source.
+func withStatus(r Result, checksums map[string]string, digests map[string]hash.Hash) Result {
+	_, verifiable := key(checksums)
+	switch r.Mismatches = verify(checksums, digests); {
+	case len(r.Mismatches) != 0:
+		r.Status = Mismatch
+	case !verifiable:
+		r.Status = Skipped
+	default:
+		r.Status = Verified
+	}
+
+	return r
+}
+
+/*
+download saves the contents of url to path, returning the digests for the declared checksums.
+The file is written beside path and renamed once complete, so a partial download is never cached.
+*/
+func (c *Cache) download(url, path string, checksums map[string]string) (map[string]hash.Hash, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, response.Status)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	digests, err := digest(f, response.Body, checksums)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save download: %w", err)
+	}
+
+	return digests, nil
+}
+
+/*
+A Request is a source to retrieve, with the function used to read it if it is bundled with its package.
+*/
+type Request struct {
+	Source srcinfo.Source
+	Open   func(name string) (io.ReadCloser, error)
+}
+
+/*
+GetAll retrieves and verifies the requested sources using up to jobs downloads at a time.
+Requests saved to the same cache file wait for the first of them, so the file is downloaded once;
+unverified sources are then shared rather than downloaded again.
+The results are in the same order as requests.
+*/
+func (c *Cache) GetAll(requests []Request, jobs int) []Result {
+	results := make([]Result, len(requests))
+	first := make(map[string]int) // cache file to the first request saved there
+	var unique, duplicates []int
+	for i, r := range requests {
+		if path, _, ok := c.path(r.Source); ok {
+			if _, seen := first[path]; seen {
+				duplicates = append(duplicates, i)
+				continue
+			}
+			first[path] = i
+		}
+		unique = append(unique, i)
+	}
+
+	limit := make(chan struct{}, max(jobs, 1))
+	getAll := func(indices []int) {
+		var wg sync.WaitGroup
+		for _, i := range indices {
+			wg.Add(1)
+			limit <- struct{}{}
+			go func() {
+				defer wg.Done()
+				results[i] = c.Get(requests[i].Source, requests[i].Open)
+				<-limit
+			}()
+		}
+		wg.Wait()
+	}
+	getAll(unique)
+
+	// verified duplicates are checked against their own checksums, which finds the cached file
+	var verifiable []int
+	for _, i := range duplicates {
+		path, ok, _ := c.path(requests[i].Source)
+		if ok {
+			verifiable = append(verifiable, i)
+			continue
+		}
+		r := results[first[path]]
+		r.Entry, r.Cached = requests[i].Source.Entry, r.Path != ""
+		results[i] = r
+	}
+	getAll(verifiable)
+
+	return results
+}
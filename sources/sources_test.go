@@ -0,0 +1,232 @@
+/*
+ * sources_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bmoller/pkg/srcinfo"
+)
+
+// fileServer serves files from a map of paths to contents, counting the requests for each path.
+type fileServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newFileServer(t *testing.T, files map[string]string) *fileServer {
+	s := &fileServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path] += 1
+		s.mu.Unlock()
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, contents)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// count returns the number of requests made for path.
+func (s *fileServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func sha256sum(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGet(t *testing.T) {
+	server := newFileServer(t, map[string]string{"/foo.tar.gz": "foo", "/foo.sig": "signature"})
+	cache := &Cache{Dir: t.TempDir(), Client: server.Client()}
+
+	tests := []struct {
+		name      string
+		source    srcinfo.Source
+		want      Status
+		cached    bool
+		mismatch  bool
+		savedFile bool
+	}{
+		{"verified", srcinfo.Source{Entry: server.URL + "/foo.tar.gz", Checksums: map[string]string{"sha256": sha256sum("foo")}}, Verified, false, false, true},
+		{"cached", srcinfo.Source{Entry: server.URL + "/foo.tar.gz", Checksums: map[string]string{"sha256": sha256sum("foo")}}, Verified, true, false, true},
+		{"mismatch", srcinfo.Source{Entry: server.URL + "/foo.tar.gz", Checksums: map[string]string{"sha256": sha256sum("bar")}}, Mismatch, false, true, false},
+		{"skipped", srcinfo.Source{Entry: server.URL + "/foo.sig", Checksums: map[string]string{"sha256": "SKIP"}}, Skipped, false, false, true},
+		{"not found", srcinfo.Source{Entry: server.URL + "/missing.tar.gz", Checksums: map[string]string{"sha256": "SKIP"}}, Failed, false, false, false},
+		{"vcs", srcinfo.Source{Entry: "git+" + server.URL + "/foo.git", Checksums: map[string]string{"sha256": "SKIP"}}, VCS, false, false, false},
+		{"bundled", srcinfo.Source{Entry: "foo.install", Checksums: map[string]string{"sha256": "SKIP"}}, Failed, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := cache.Get(tt.source, nil)
+			if r.Status != tt.want {
+				t.Errorf("Status = %s, want %s (%s)", r.Status, tt.want, r.Error)
+			}
+			if r.Cached != tt.cached {
+				t.Errorf("Cached = %v, want %v", r.Cached, tt.cached)
+			}
+			if (len(r.Mismatches) != 0) != tt.mismatch {
+				t.Errorf("Mismatches = %q", r.Mismatches)
+			}
+			if _, err := os.Stat(r.Path); (r.Path != "" && err == nil) != tt.savedFile {
+				t.Errorf("Path = %q, saved file expected: %v", r.Path, tt.savedFile)
+			}
+		})
+	}
+	if n := server.count("/foo.tar.gz"); n != 2 {
+		t.Errorf("foo.tar.gz downloaded %d times, want 2", n)
+	}
+}
+
+func TestGetBundled(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	open := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("bundled " + name)), nil
+	}
+
+	r := cache.Get(srcinfo.Source{Entry: "foo.install", Checksums: map[string]string{"sha256": sha256sum("bundled foo.install")}}, open)
+	if r.Status != Verified || r.Path != "" {
+		t.Errorf("Get() = %+v, want verified and not saved", r)
+	}
+	r = cache.Get(srcinfo.Source{Entry: "foo.install", Checksums: map[string]string{"sha256": sha256sum("other")}}, open)
+	if r.Status != Mismatch {
+		t.Errorf("Status = %s, want %s", r.Status, Mismatch)
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	server := newFileServer(t, map[string]string{
+		"/foo.tar.gz":    "foo",
+		"/a/release.sig": "signature a",
+		"/b/release.sig": "signature b",
+		"/shared.tar.gz": "shared",
+	})
+	cache := &Cache{Dir: t.TempDir(), Client: server.Client()}
+	skip := map[string]string{"sha256": "SKIP"}
+
+	requests := []Request{
+		{Source: srcinfo.Source{Entry: server.URL + "/foo.tar.gz", Checksums: map[string]string{"sha256": sha256sum("foo")}}},
+		{Source: srcinfo.Source{Entry: "foo.tar.gz::" + server.URL + "/foo.tar.gz", Checksums: map[string]string{"sha256": sha256sum("foo"), "md5": "0"}}},
+		{Source: srcinfo.Source{Entry: server.URL + "/a/release.sig", Checksums: skip}},
+		{Source: srcinfo.Source{Entry: server.URL + "/b/release.sig", Checksums: skip}},
+		{Source: srcinfo.Source{Entry: server.URL + "/shared.tar.gz", Checksums: skip}},
+		{Source: srcinfo.Source{Entry: server.URL + "/shared.tar.gz", Checksums: skip}},
+	}
+	results := cache.GetAll(requests, 4)
+
+	wantStatus := []Status{Verified, Mismatch, Skipped, Skipped, Skipped, Skipped}
+	for i, r := range results {
+		if r.Entry != requests[i].Source.Entry {
+			t.Errorf("result %d has entry %q, want %q", i, r.Entry, requests[i].Source.Entry)
+		}
+		if r.Status != wantStatus[i] {
+			t.Errorf("result %d has status %s, want %s (%s)", i, r.Status, wantStatus[i], r.Error)
+		}
+	}
+
+	// same-named unverified files from different URLs are kept apart
+	for i, want := range []string{"signature a", "signature b"} {
+		contents, err := os.ReadFile(results[2+i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != want {
+			t.Errorf("%s holds %q, want %q", results[2+i].Path, contents, want)
+		}
+	}
+	// a cached file is reused but still checked against every declared checksum
+	if !results[1].Cached || results[1].Path != "" {
+		t.Errorf("duplicate verified source not checked against the cache: %+v", results[1])
+	}
+	if _, err := os.Stat(results[0].Path); err != nil {
+		t.Errorf("verified download removed: %v", err)
+	}
+	if !results[5].Cached || results[5].Path != results[4].Path {
+		t.Errorf("duplicate unverified source not shared: %+v", results[5])
+	}
+
+	for _, path := range []string{"/foo.tar.gz", "/a/release.sig", "/b/release.sig", "/shared.tar.gz"} {
+		if n := server.count(path); n != 1 {
+			t.Errorf("%s downloaded %d times, want 1", path, n)
+		}
+	}
+}
+
+func TestGetUnsafeName(t *testing.T) {
+	server := newFileServer(t, map[string]string{"/file.txt": "contents"})
+	root := t.TempDir()
+	cache := &Cache{Dir: filepath.Join(root, "a", "b", "cache"), Client: server.Client()}
+
+	tests := []struct {
+		name      string
+		entry     string
+		checksums map[string]string
+	}{
+		{"parent directories", "../../../escaped.txt::" + server.URL + "/file.txt", map[string]string{"sha256": "SKIP"}},
+		{"parent", "..::" + server.URL + "/file.txt", map[string]string{"sha256": "SKIP"}},
+		{"current", ".::" + server.URL + "/file.txt", map[string]string{"sha256": "SKIP"}},
+		{"subdirectory", "sub/file.txt::" + server.URL + "/file.txt", map[string]string{"sha256": "SKIP"}},
+		{"checksum", server.URL + "/file.txt", map[string]string{"sha256": "../../../escaped"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := cache.Get(srcinfo.Source{Entry: tt.entry, Checksums: tt.checksums}, nil)
+			if r.Status != Failed || r.Path != "" {
+				t.Errorf("Get() = %+v, want a failure without a saved file", r)
+			}
+			results := cache.GetAll([]Request{{Source: srcinfo.Source{Entry: tt.entry, Checksums: tt.checksums}}}, 1)
+			if results[0].Status != Failed {
+				t.Errorf("GetAll() = %+v, want a failure", results[0])
+			}
+		})
+	}
+
+	if n := server.count("/file.txt"); n != 0 {
+		t.Errorf("file.txt downloaded %d times, want 0", n)
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("file %s written", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ * srcinfo.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package srcinfo parses the .SRCINFO metadata files published with AUR packages.
+*/
+package srcinfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+/*
+A Section is one block of a .SRCINFO file: the pkgbase block or a pkgname block.
+Values holds every value assigned to each key, in file order.
+*/
+type Section struct {
+	Name   string
+	Values map[string][]string
+}
+
+/*
+Get returns the first value assigned to key, or an empty string if there is none.
+*/
+func (s Section) Get(key string) string {
+	if v := s.Values[key]; len(v) != 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+/*
+An SrcInfo is a parsed .SRCINFO file.
+*/
+type SrcInfo struct {
+	Base     Section   // the pkgbase section
+	Packages []Section // each pkgname section, holding only values it overrides
+}
+
+/*
+Parse reads a .SRCINFO file from r.
+Any read error or malformed line is returned in err.
+*/
+func Parse(r io.Reader) (info *SrcInfo, err error) {
+	info = new(SrcInfo)
+	var current *Section
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key = value'", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "pkgbase":
+			info.Base = Section{Name: value, Values: make(map[string][]string)}
+			current = &info.Base
+		case "pkgname":
+			if info.Base.Name == "" {
+				return nil, fmt.Errorf("line %d: pkgname before pkgbase", n)
+			}
+			info.Packages = append(info.Packages, Section{Name: value, Values: make(map[string][]string)})
+			current = &info.Packages[len(info.Packages)-1]
+		default:
+			if current == nil {
+				return nil, fmt.Errorf("line %d: '%s' before pkgbase", n, key)
+			}
+			current.Values[key] = append(current.Values[key], value)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading .SRCINFO: %w", err)
+	}
+	if info.Base.Name == "" {
+		return nil, fmt.Errorf("no pkgbase found")
+	}
+
+	return
+}
+
+/*
+ParseFile reads the .SRCINFO file at path.
+*/
+func ParseFile(path string) (*SrcInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+/*
+Version returns the full version of the package base in pacman's epoch:pkgver-pkgrel format.
+*/
+func (s *SrcInfo) Version() string {
+	version := s.Base.Get("pkgver") + "-" + s.Base.Get("pkgrel")
+	if epoch := s.Base.Get("epoch"); epoch != "" && epoch != "0" {
+		version = epoch + ":" + version
+	}
+
+	return version
+}
+
+/*
+Package returns the section for the named package with values inherited from the pkgbase section.
+A key overridden in the package section replaces the pkgbase values entirely, as in makepkg.
+ok is false if no package has that name.
+*/
+func (s *SrcInfo) Package(name string) (pkg Section, ok bool) {
+	for _, p := range s.Packages {
+		if p.Name == name {
+			pkg = Section{Name: name, Values: maps.Clone(s.Base.Values)}
+			maps.Copy(pkg.Values, p.Values)
+			return pkg, true
+		}
+	}
+
+	return Section{}, false
+}
+
+/*
+Architecture returns the values of key for the pkgbase, including those specific to arch.
+For example, Architecture("source", "x86_64") combines "source" and "source_x86_64".
+*/
+func (s *SrcInfo) Architecture(key, arch string) []string {
+	values := append([]string(nil), s.Base.Values[key]...)
+
+	return append(values, s.Base.Values[key+"_"+arch]...)
+}
+
+// ChecksumAlgorithms are the prefixes of the checksum arrays makepkg supports, such as sha256 for sha256sums.
+var ChecksumAlgorithms = []string{"ck", "md5", "sha1", "sha224", "sha256", "sha384", "sha512", "b2"}
+
+/*
+A Source is one entry of a source array with the checksums declared for it.
+*/
+type Source struct {
+	Entry     string            // the source array entry, e.g. "name::https://example.com/file.tar.gz"
+	Arch      string            // architecture of the source array, or empty for the common array
+	Checksums map[string]string // checksum by algorithm, e.g. "sha256"; "SKIP" if the check is skipped
+}
+
+/*
+Sources returns every source of the pkgbase, from the common source array and
+each architecture-specific array, paired with the checksums at the same index of the matching checksum arrays.
+*/
+func (s *SrcInfo) Sources() (sources []Source) {
+	var suffixes []string
+	for key := range s.Base.Values {
+		if suffix, ok := strings.CutPrefix(key, "source"); ok && (suffix == "" || strings.HasPrefix(suffix, "_")) {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	slices.Sort(suffixes)
+
+	for _, suffix := range suffixes {
+		for i, entry := range s.Base.Values["source"+suffix] {
+			source := Source{Entry: entry, Arch: strings.TrimPrefix(suffix, "_"), Checksums: make(map[string]string)}
+			for _, algorithm := range ChecksumAlgorithms {
+				if sums := s.Base.Values[algorithm+"sums"+suffix]; i < len(sums) {
+					source.Checksums[algorithm] = sums[i]
+				}
+			}
+			sources = append(sources, source)
+		}
+	}
+
+	return
+}
+
+/*
+Skipped reports whether every checksum of the source is SKIP, or none is declared.
+*/
+func (s Source) Skipped() bool {
+	for _, sum := range s.Checksums {
+		if sum != "SKIP" {
+			return false
+		}
+	}
+
+	return true
+}
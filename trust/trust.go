@@ -0,0 +1,220 @@
+/*
+ * trust.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package trust scores how much confidence the AUR's metadata gives in a package.
+Each factor earns a share of its weight depending on how close the package comes
+to the factor's target; the score is the points earned as a percentage of the
+total weight, so every point can be traced to a factor.
+*/
+package trust
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bmoller/pkg/aur"
+)
+
+/*
+A Rule sets the weight of a factor and the value that earns all of it.
+A factor with a weight of zero is not scored.
+*/
+type Rule struct {
+	Weight float64 `yaml:"weight"` // points the factor earns at most
+	Target float64 `yaml:"target"` // value earning the full weight; for churn, the most commits that do
+}
+
+/*
+A Config holds the rules of each factor and the lowest acceptable score.
+*/
+type Config struct {
+	Minimum     float64 `yaml:"minimum"`      // scores below this fail the check
+	ChurnWindow int     `yaml:"churn-window"` // days of commits counted as recent churn
+
+	Votes              Rule `yaml:"votes"`               // number of votes, scored logarithmically
+	Popularity         Rule `yaml:"popularity"`          // the AUR's popularity, based on recent votes
+	Age                Rule `yaml:"age"`                 // days since the package was first submitted
+	Maintained         Rule `yaml:"maintained"`          // earned in full unless the package is orphaned
+	UpToDate           Rule `yaml:"up-to-date"`          // earned in full unless flagged out of date
+	CoMaintainers      Rule `yaml:"co-maintainers"`      // number of co-maintainers
+	MaintainerPackages Rule `yaml:"maintainer-packages"` // number of packages the maintainer maintains
+	Churn              Rule `yaml:"churn"`               // commits within the churn window
+}
+
+/*
+DefaultConfig returns the rules used for any setting a configuration file does not change.
+The weights add up to 100.
+*/
+func DefaultConfig() Config {
+	return Config{
+		Minimum:     50,
+		ChurnWindow: 30,
+
+		Votes:              Rule{Weight: 20, Target: 100},
+		Popularity:         Rule{Weight: 15, Target: 1},
+		Age:                Rule{Weight: 15, Target: 365},
+		Maintained:         Rule{Weight: 15},
+		UpToDate:           Rule{Weight: 10},
+		CoMaintainers:      Rule{Weight: 5, Target: 1},
+		MaintainerPackages: Rule{Weight: 10, Target: 10},
+		Churn:              Rule{Weight: 10, Target: 5},
+	}
+}
+
+/*
+LoadConfig reads a YAML configuration from the file at path over the default configuration.
+Settings missing from the file keep their defaults; a missing file gives the default configuration.
+*/
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return Config{}, fmt.Errorf("failed to open trust configuration: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("failed to parse trust configuration %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+/*
+Signals are the facts about a package a score is computed from.
+*/
+type Signals struct {
+	Package            aur.Package
+	MaintainerPackages int // packages maintained by the package's maintainer
+	RecentCommits      int // commits to the package base within the churn window
+}
+
+/*
+A Contribution is the points a single factor added to a score.
+*/
+type Contribution struct {
+	Factor string
+	Value  float64 // the measured value, such as the number of votes
+	Points float64
+	Weight float64
+	Detail string // the value explained for display
+}
+
+/*
+A Score is a package's total score out of 100 and the contributions making it up.
+*/
+type Score struct {
+	Total   float64
+	Factors []Contribution
+}
+
+// fraction returns how much of target value reaches, from 0 to 1. Any value reaches a target of zero or less.
+func fraction(value, target float64) float64 {
+	if target <= 0 {
+		return 1
+	}
+
+	return math.Max(0, math.Min(1, value/target))
+}
+
+// days returns the number of whole days from the Unix time t to now.
+func days(t int, now time.Time) float64 {
+	return math.Floor(now.Sub(time.Unix(int64(t), 0)).Hours() / 24)
+}
+
+// round rounds x to one decimal place, for display.
+func round(x float64) float64 {
+	return math.Round(x*10) / 10
+}
+
+/*
+Score computes the score of the package described by s as of now.
+*/
+func (c Config) Score(s Signals, now time.Time) (score Score) {
+	p := s.Package
+	add := func(factor string, r Rule, value, earned float64, detail string) {
+		if r.Weight > 0 {
+			score.Factors = append(score.Factors, Contribution{factor, value, round(r.Weight * earned), r.Weight, detail})
+		}
+	}
+
+	votes := float64(p.NumVotes)
+	add("votes", c.Votes, votes, fraction(math.Log1p(votes), math.Log1p(c.Votes.Target)), fmt.Sprintf("%d votes", p.NumVotes))
+
+	popularity, _ := p.Popularity.Float64()
+	add("popularity", c.Popularity, popularity, fraction(popularity, c.Popularity.Target), fmt.Sprintf("popularity %.2f", popularity))
+
+	age := days(p.FirstSubmitted, now)
+	add("age", c.Age, age, fraction(age, c.Age.Target), fmt.Sprintf("first submitted %.0f days ago", age))
+
+	if p.Maintainer == "" {
+		add("maintained", c.Maintained, 0, 0, "orphaned")
+	} else {
+		add("maintained", c.Maintained, 1, 1, "maintained by "+p.Maintainer)
+	}
+
+	if p.OutOfDate == 0 {
+		add("up-to-date", c.UpToDate, 0, 1, "not flagged out of date")
+	} else {
+		flagged := days(p.OutOfDate, now)
+		add("up-to-date", c.UpToDate, flagged, 0, fmt.Sprintf("flagged out of date %.0f days ago", flagged))
+	}
+
+	coMaintainers := float64(len(p.CoMaintainers))
+	add("co-maintainers", c.CoMaintainers, coMaintainers, fraction(coMaintainers, c.CoMaintainers.Target),
+		fmt.Sprintf("%d co-maintainers", len(p.CoMaintainers)))
+
+	maintained := float64(s.MaintainerPackages)
+	if p.Maintainer == "" {
+		add("maintainer-packages", c.MaintainerPackages, 0, 0, "no maintainer")
+	} else {
+		add("maintainer-packages", c.MaintainerPackages, maintained, fraction(maintained, c.MaintainerPackages.Target),
+			fmt.Sprintf("%s maintains %d packages", p.Maintainer, s.MaintainerPackages))
+	}
+
+	// churn earns its full weight up to the target number of commits, then less the more commits there are
+	commits := float64(s.RecentCommits)
+	churn := 1.0
+	if commits > c.Churn.Target {
+		churn = fraction(c.Churn.Target, commits)
+	}
+	add("churn", c.Churn, commits, churn, fmt.Sprintf("%d commits in the last %d days", s.RecentCommits, c.ChurnWindow))
+
+	var points, weight float64
+	for _, f := range score.Factors {
+		points += f.Points
+		weight += f.Weight
+	}
+	if weight > 0 {
+		score.Total = round(100 * points / weight)
+	}
+
+	return
+}
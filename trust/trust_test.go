@@ -0,0 +1,170 @@
+/*
+ * trust_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package trust
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bmoller/pkg/aur"
+)
+
+var now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// daysAgo returns the Unix timestamp n days before now.
+func daysAgo(n int) int {
+	return int(now.AddDate(0, 0, -n).Unix())
+}
+
+// healthy returns signals earning every factor's full weight under the default configuration.
+func healthy() Signals {
+	return Signals{
+		Package: aur.Package{
+			Name: "example", NumVotes: 100, Popularity: json.Number("1.5"), FirstSubmitted: daysAgo(400),
+			Maintainer: "someone", CoMaintainers: []string{"other"},
+		},
+		MaintainerPackages: 12,
+		RecentCommits:      3,
+	}
+}
+
+// points returns the points of each factor in score.
+func points(score Score) map[string]float64 {
+	m := make(map[string]float64)
+	for _, f := range score.Factors {
+		m[f.Factor] = f.Points
+	}
+	return m
+}
+
+func TestDefaultConfig(t *testing.T) {
+	c := DefaultConfig()
+	total := 0.0
+	for _, r := range []Rule{c.Votes, c.Popularity, c.Age, c.Maintained, c.UpToDate, c.CoMaintainers, c.MaintainerPackages, c.Churn} {
+		total += r.Weight
+	}
+	if total != 100 {
+		t.Errorf("default weights add up to %g, want 100", total)
+	}
+	if score := c.Score(healthy(), now); score.Total != 100 || len(score.Factors) != 8 {
+		t.Errorf("Score(healthy) = %g with %d factors, want 100 with 8", score.Total, len(score.Factors))
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config, s *Signals)
+		total  float64
+		points map[string]float64 // points of the factors that changed
+	}{
+		{"orphaned", func(c *Config, s *Signals) { s.Package.Maintainer = "" },
+			75, map[string]float64{"maintained": 0, "maintainer-packages": 0}},
+		{"flagged", func(c *Config, s *Signals) { s.Package.OutOfDate = daysAgo(10) },
+			90, map[string]float64{"up-to-date": 0}},
+		{"churn at target", func(c *Config, s *Signals) { s.RecentCommits = 5 },
+			100, map[string]float64{"churn": 10}},
+		{"churn above target", func(c *Config, s *Signals) { s.RecentCommits = 20 },
+			92.5, map[string]float64{"churn": 2.5}},
+		{"half the age", func(c *Config, s *Signals) { s.Package.FirstSubmitted = daysAgo(182) },
+			92.5, map[string]float64{"age": 7.5}},
+		{"no votes", func(c *Config, s *Signals) { s.Package.NumVotes = 0 },
+			80, map[string]float64{"votes": 0}},
+		{"zero-weight factors", func(c *Config, s *Signals) {
+			c.Votes.Weight, c.Churn.Weight = 0, 0
+			s.Package.NumVotes, s.RecentCommits = 0, 100
+		}, 100, nil},
+		{"zero-weight factors with a missed factor", func(c *Config, s *Signals) {
+			c.Votes.Weight, c.Churn.Weight = 0, 0
+			s.Package.OutOfDate = daysAgo(1)
+		}, 85.7, map[string]float64{"up-to-date": 0}},
+	}
+	for _, tt := range tests {
+		c, s := DefaultConfig(), healthy()
+		tt.modify(&c, &s)
+		score := c.Score(s, now)
+		if score.Total != tt.total {
+			t.Errorf("%s: Score total = %g, want %g", tt.name, score.Total, tt.total)
+		}
+		got := points(score)
+		for factor, want := range tt.points {
+			if got[factor] != want {
+				t.Errorf("%s: %s earned %g points, want %g", tt.name, factor, got[factor], want)
+			}
+		}
+		for _, f := range score.Factors {
+			if f.Weight == 0 {
+				t.Errorf("%s: zero-weight factor %s was scored", tt.name, f.Factor)
+			}
+		}
+	}
+
+	c := DefaultConfig()
+	c.Votes.Weight, c.Churn.Weight = 0, 0
+	for _, f := range c.Score(healthy(), now).Factors {
+		if slices.Contains([]string{"votes", "churn"}, f.Factor) {
+			t.Errorf("zero-weight factor %s listed", f.Factor)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if c, err := LoadConfig(filepath.Join(dir, "missing.yaml")); err != nil || c != DefaultConfig() {
+		t.Errorf("LoadConfig(missing) = %+v, %v; want the defaults", c, err)
+	}
+	if c, err := LoadConfig(write("empty.yaml", "")); err != nil || c != DefaultConfig() {
+		t.Errorf("LoadConfig(empty) = %+v, %v; want the defaults", c, err)
+	}
+
+	c, err := LoadConfig(write("partial.yaml", "minimum: 70\nvotes: {weight: 30}\nchurn:\n  weight: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultConfig()
+	want.Minimum = 70
+	// a rule's settings missing from the file keep their defaults too
+	want.Votes.Weight = 30
+	want.Churn.Weight = 0
+	if c != want {
+		t.Errorf("LoadConfig(partial) = %+v, want %+v", c, want)
+	}
+
+	for name, contents := range map[string]string{
+		"unknown.yaml":      "minimum: 50\nstars: {weight: 10}\n",
+		"unknown-rule.yaml": "votes: {weight: 10, goal: 5}\n",
+		"invalid.yaml":      "minimum: high\n",
+	} {
+		if _, err := LoadConfig(write(name, contents)); err == nil {
+			t.Errorf("LoadConfig(%s) succeeded", name)
+		}
+	}
+}
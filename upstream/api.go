@@ -0,0 +1,162 @@
+/*
+ * api.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// User-Agent sent with requests; crates.io rejects requests without one
+const userAgent = "pkg (https://github.com/bmoller/pkg)"
+
+/*
+get requests target with the headers given and returns the response body.
+Any status other than 200 OK is an error.
+*/
+func (c *Checker) get(target string, headers map[string]string) ([]byte, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", target, err)
+	}
+	request.Header.Set("User-Agent", userAgent)
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve %s: %s", target, response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return body, nil
+}
+
+// getJSON requests target and decodes the JSON response into v.
+func (c *Checker) getJSON(target string, headers map[string]string, v any) error {
+	body, err := c.get(target, headers)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON response: %w", err)
+	}
+
+	return nil
+}
+
+/*
+github returns the tag of the latest release of the repository, which excludes drafts and prereleases.
+A token in GITHUB_TOKEN is sent to raise the API's rate limit.
+*/
+func (c *Checker) github(s Source) ([]string, error) {
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := c.getJSON(s.api()+"/repos/"+s.Repo+"/releases/latest", headers, &release); err != nil {
+		return nil, err
+	}
+
+	return []string{release.TagName}, nil
+}
+
+/*
+gitlab returns the tag of the most recent release of the project, skipping upcoming releases.
+A token in GITLAB_TOKEN is sent to read private projects.
+*/
+func (c *Checker) gitlab(s Source) ([]string, error) {
+	headers := make(map[string]string)
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		headers["PRIVATE-TOKEN"] = token
+	}
+	var releases []struct {
+		TagName  string `json:"tag_name"`
+		Upcoming bool   `json:"upcoming_release"`
+	}
+	target := s.api() + "/api/v4/projects/" + url.PathEscape(s.Repo) + "/releases"
+	if err := c.getJSON(target, headers, &releases); err != nil {
+		return nil, err
+	}
+
+	// releases are listed newest first
+	for _, r := range releases {
+		if !r.Upcoming {
+			return []string{r.TagName}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+/*
+pypi returns the current version of the package on PyPI.
+*/
+func (c *Checker) pypi(s Source) ([]string, error) {
+	var project struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := c.getJSON(s.api()+"/pypi/"+url.PathEscape(s.Name)+"/json", nil, &project); err != nil {
+		return nil, err
+	}
+
+	return []string{project.Info.Version}, nil
+}
+
+/*
+crates returns the highest stable version of the crate, or its highest version if it has no stable release.
+*/
+func (c *Checker) crates(s Source) ([]string, error) {
+	var crate struct {
+		Crate struct {
+			MaxStableVersion string `json:"max_stable_version"`
+			MaxVersion       string `json:"max_version"`
+		} `json:"crate"`
+	}
+	if err := c.getJSON(s.api()+"/api/v1/crates/"+url.PathEscape(s.Name), nil, &crate); err != nil {
+		return nil, err
+	}
+	if crate.Crate.MaxStableVersion != "" {
+		return []string{crate.Crate.MaxStableVersion}, nil
+	}
+
+	return []string{crate.Crate.MaxVersion}, nil
+}
@@ -0,0 +1,250 @@
+/*
+ * upstream.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package upstream finds the latest versions released by the upstream projects of packages.
+Each package is configured with a Source describing where its releases are published.
+*/
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bmoller/pkg/libalpm"
+)
+
+// kinds of upstream sources
+const (
+	GitHub = "github" // the latest release of a GitHub repository
+	GitLab = "gitlab" // the latest release of a GitLab project
+	Regex  = "regex"  // the highest version matched by a regular expression in a web page
+	Git    = "git"    // the highest version among the tags of a git repository
+	PyPI   = "pypi"   // the version of a Python package on PyPI
+	Crates = "crates" // the latest stable version of a Rust crate on crates.io
+)
+
+// default API locations of the hosted services
+var defaultAPIs = map[string]string{
+	GitHub: "https://api.github.com",
+	GitLab: "https://gitlab.com",
+	PyPI:   "https://pypi.org",
+	Crates: "https://crates.io",
+}
+
+/*
+A Source describes where the upstream project of a package publishes its versions.
+Which fields are needed depends on Kind.
+*/
+type Source struct {
+	Kind   string `yaml:"source"` // one of the kinds of sources, such as github
+	Repo   string `yaml:"repo"`   // owner/name on GitHub, or the project path on GitLab
+	Name   string `yaml:"name"`   // package name on PyPI or crates.io
+	URL    string `yaml:"url"`    // web page for regex, repository for git
+	Regex  string `yaml:"regex"`  // pattern matching versions in a page or releases; its first group is the version, if it has one
+	Prefix string `yaml:"prefix"` // removed from the start of versions, such as "v"
+	API    string `yaml:"api"`    // base URL of the service, for self-hosted instances or stand-ins
+}
+
+/*
+validate checks that the fields source s needs are set and its pattern compiles.
+*/
+func (s Source) validate() error {
+	required := map[string][]string{
+		GitHub: {"repo", s.Repo},
+		GitLab: {"repo", s.Repo},
+		Regex:  {"url", s.URL},
+		Git:    {"url", s.URL},
+		PyPI:   {"name", s.Name},
+		Crates: {"name", s.Name},
+	}
+	field, ok := required[s.Kind]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown source '%s'; expected one of github, gitlab, regex, git, pypi, crates", s.Kind)
+	case field[1] == "":
+		return fmt.Errorf("%s source requires %s", s.Kind, field[0])
+	case s.Kind == Regex && s.Regex == "":
+		return fmt.Errorf("regex source requires regex")
+	}
+	if _, err := regexp.Compile(s.Regex); err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+
+	return nil
+}
+
+// api returns the base URL of the service s queries, without a trailing slash.
+func (s Source) api() string {
+	if s.API != "" {
+		return strings.TrimSuffix(s.API, "/")
+	}
+
+	return defaultAPIs[s.Kind]
+}
+
+/*
+A Config maps package names to the sources of their upstream versions.
+*/
+type Config map[string]Source
+
+/*
+LoadConfig reads a YAML mapping of package names to sources from the file at path, for example:
+
+	foo:
+	  source: github
+	  repo: owner/foo
+	  prefix: v
+
+A missing file gives an empty configuration. Every source is validated.
+*/
+func LoadConfig(path string) (Config, error) {
+	config := make(Config)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open upstream configuration: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse upstream configuration %s: %w", path, err)
+	}
+	for name, s := range config {
+		if err = s.validate(); err != nil {
+			return nil, fmt.Errorf("upstream configuration of '%s': %w", name, err)
+		}
+	}
+
+	return config, nil
+}
+
+/*
+A Checker looks up upstream versions.
+*/
+type Checker struct {
+	Client *http.Client // client used for requests; http.DefaultClient if nil
+}
+
+/*
+Latest returns the latest upstream version published by the source s, with s.Prefix removed.
+*/
+func (c *Checker) Latest(s Source) (version string, err error) {
+	if err = s.validate(); err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	switch s.Kind {
+	case GitHub:
+		candidates, err = c.github(s)
+	case GitLab:
+		candidates, err = c.gitlab(s)
+	case Regex:
+		candidates, err = c.page(s)
+	case Git:
+		candidates, err = tags(s)
+	case PyPI:
+		candidates, err = c.pypi(s)
+	case Crates:
+		candidates, err = c.crates(s)
+	}
+	if err != nil {
+		return "", err
+	}
+	// the pattern of other sources selects and extracts versions from their tags
+	if s.Kind != Regex && s.Regex != "" {
+		candidates = match(regexp.MustCompile(s.Regex), candidates)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no versions found")
+	}
+
+	for i, v := range candidates {
+		candidates[i] = strings.TrimPrefix(v, s.Prefix)
+	}
+
+	return slices.MaxFunc(candidates, libalpm.CompareVersions), nil
+}
+
+/*
+match returns the matches of pattern in each string of texts: the first group if the pattern has one,
+or else the whole match. Strings that do not match are dropped.
+*/
+func match(pattern *regexp.Regexp, texts []string) (matches []string) {
+	for _, text := range texts {
+		for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+			matches = append(matches, m[min(1, len(m)-1)])
+		}
+	}
+
+	return
+}
+
+/*
+page returns every version matched by the source's pattern in the web page at its URL.
+*/
+func (c *Checker) page(s Source) ([]string, error) {
+	body, err := c.get(s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return match(regexp.MustCompile(s.Regex), []string{string(body)}), nil
+}
+
+/*
+tags returns the tags of the git repository at the source's URL, which may be any URL git can read.
+*/
+func tags(s Source) (tags []string, err error) {
+	var stderr bytes.Buffer
+	c := exec.Command("git", "ls-remote", "--tags", "--refs", "--", s.URL)
+	c.Stderr = &stderr
+	c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %s", s.URL, cmp.Or(strings.TrimSpace(stderr.String()), err.Error()))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if _, ref, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return
+}
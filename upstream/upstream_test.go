@@ -0,0 +1,192 @@
+/*
+ * upstream_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newService stands in for the hosted services, serving bodies by escaped request path.
+func newService(t *testing.T, routes map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			http.Error(w, "missing User-Agent", http.StatusForbidden)
+			return
+		}
+		body, ok := routes[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestLatest(t *testing.T) {
+	server := newService(t, map[string]string{
+		"/repos/owner/foo/releases/latest":           `{"tag_name": "v1.2.0"}`,
+		"/api/v4/projects/group%2Fbar/releases":      `[{"tag_name": "v3.0", "upcoming_release": true}, {"tag_name": "v2.10"}, {"tag_name": "v2.9"}]`,
+		"/api/v4/projects/group%2Fupcoming/releases": `[{"tag_name": "v1.0", "upcoming_release": true}]`,
+		"/downloads/":           `<a href="baz-1.9.tar.gz">baz-1.9.tar.gz</a> <a href="baz-1.10.tar.gz">baz-1.10.tar.gz</a> <a href="baz-2.0rc1.zip">`,
+		"/pypi/quux/json":       `{"info": {"version": "0.4.1"}}`,
+		"/api/v1/crates/corge":  `{"crate": {"max_stable_version": "1.3.0", "max_version": "2.0.0-beta.1"}}`,
+		"/api/v1/crates/grault": `{"crate": {"max_stable_version": null, "max_version": "0.1.0-alpha"}}`,
+	})
+	checker := &Checker{Client: server.Client()}
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr bool
+	}{
+		{"github", Source{Kind: GitHub, Repo: "owner/foo", Prefix: "v", API: server.URL}, "1.2.0", false},
+		{"github missing", Source{Kind: GitHub, Repo: "owner/missing", API: server.URL}, "", true},
+		{"gitlab", Source{Kind: GitLab, Repo: "group/bar", Prefix: "v", API: server.URL + "/"}, "2.10", false},
+		{"gitlab upcoming only", Source{Kind: GitLab, Repo: "group/upcoming", API: server.URL}, "", true},
+		{"regex", Source{Kind: Regex, URL: server.URL + "/downloads/", Regex: `baz-([0-9.]+)\.tar\.gz`}, "1.10", false},
+		{"regex without matches", Source{Kind: Regex, URL: server.URL + "/downloads/", Regex: `qux-([0-9.]+)`}, "", true},
+		{"pypi", Source{Kind: PyPI, Name: "quux", API: server.URL}, "0.4.1", false},
+		{"crates", Source{Kind: Crates, Name: "corge", API: server.URL}, "1.3.0", false},
+		{"crates without stable release", Source{Kind: Crates, Name: "grault", API: server.URL}, "0.1.0-alpha", false},
+		{"invalid source", Source{Kind: "cvs"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checker.Latest(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Latest() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Latest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestTokens(t *testing.T) {
+	headers := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers[r.URL.Path] = r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		if strings.HasPrefix(r.URL.Path, "/repos/") {
+			w.Write([]byte(`{"tag_name": "1.0"}`))
+		} else {
+			w.Write([]byte(`[{"tag_name": "1.0"}]`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITHUB_TOKEN", "github-secret")
+	t.Setenv("GITLAB_TOKEN", "gitlab-secret")
+
+	checker := &Checker{Client: server.Client()}
+	for _, s := range []Source{{Kind: GitHub, Repo: "owner/foo", API: server.URL}, {Kind: GitLab, Repo: "bar", API: server.URL}} {
+		if _, err := checker.Latest(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := headers["/repos/owner/foo/releases/latest"]; got != "Bearer github-secret" {
+		t.Errorf("GitHub authorization = %q", got)
+	}
+	if got := headers["/api/v4/projects/bar/releases"]; got != "gitlab-secret" {
+		t.Errorf("GitLab token = %q", got)
+	}
+}
+
+func TestLatestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "--message=test"},
+		{"tag", "v1.9"},
+		{"tag", "v1.10"},
+		{"tag", "nightly"},
+	} {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	checker := &Checker{}
+	got, err := checker.Latest(Source{Kind: Git, URL: dir, Regex: `^v([0-9.]+)$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "1.10" {
+		t.Errorf("Latest() = %q, want %q", got, "1.10")
+	}
+	if _, err = checker.Latest(Source{Kind: Git, URL: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Latest() of a missing repository succeeded")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    Config
+		wantErr bool
+	}{
+		{"empty", "", Config{}, false},
+		{"sources", "foo:\n  source: github\n  repo: owner/foo\n  prefix: v\nbar:\n  source: pypi\n  name: bar\n",
+			Config{"foo": {Kind: GitHub, Repo: "owner/foo", Prefix: "v"}, "bar": {Kind: PyPI, Name: "bar"}}, false},
+		{"unknown source", "foo:\n  source: cvs\n", nil, true},
+		{"missing field", "foo:\n  source: gitlab\n", nil, true},
+		{"regex required", "foo:\n  source: regex\n  url: https://example.com\n", nil, true},
+		{"invalid regex", "foo:\n  source: git\n  url: https://example.com/foo.git\n  regex: \"(\"\n", nil, true},
+		{"unknown field", "foo:\n  source: pypi\n  name: foo\n  branch: main\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "upstream.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadConfig() = %+v, want %+v", got, tt.want)
+			}
+			for name, s := range tt.want {
+				if got[name] != s {
+					t.Errorf("source of %s = %+v, want %+v", name, got[name], s)
+				}
+			}
+		})
+	}
+
+	if config, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err != nil || len(config) != 0 {
+		t.Errorf("LoadConfig() of a missing file = %v, %v; want an empty configuration", config, err)
+	}
+}
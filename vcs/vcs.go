@@ -0,0 +1,215 @@
+/*
+ * vcs.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+Package vcs inspects the version control sources of development packages.
+*/
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// suffixes used by the AUR's VCS package guidelines
+var develSuffixes = []string{"-git", "-svn", "-hg", "-bzr", "-darcs", "-fossil", "-cvs"}
+
+// version control systems with a supported upstream query
+var supported = []string{"git", "hg", "svn"}
+
+/*
+IsDevel reports whether a package name follows the naming convention for VCS packages.
+*/
+func IsDevel(name string) bool {
+	return slices.ContainsFunc(develSuffixes, func(s string) bool { return strings.HasSuffix(name, s) })
+}
+
+/*
+A Source is a single entry of a PKGBUILD's source array, in the form
+"[name::][vcs+]url[#fragment]".
+*/
+type Source struct {
+	Name     string // directory or file name the source is saved as
+	VCS      string // version control system, or empty for plain downloads
+	URL      string // location of the source, without the VCS prefix or fragment
+	Fragment string // reference to check out, e.g. "branch=main"
+}
+
+/*
+ParseSource splits a source array entry into its components.
+The VCS is taken from the "vcs+" prefix, or from a "git://" URL scheme.
+*/
+func ParseSource(entry string) (s Source) {
+	if name, rest, ok := strings.Cut(entry, "::"); ok {
+		s.Name, entry = name, rest
+	}
+	if url, fragment, ok := strings.Cut(entry, "#"); ok {
+		entry, s.Fragment = url, fragment
+	}
+	if scheme, _, ok := strings.Cut(entry, "://"); ok {
+		if vcs, _, ok := strings.Cut(scheme, "+"); ok {
+			s.VCS = vcs
+			entry = strings.TrimPrefix(entry, vcs+"+")
+		} else if scheme == "git" {
+			s.VCS = "git"
+		}
+	}
+	s.URL = entry
+	if s.Name == "" {
+		s.Name = entry[strings.LastIndex(entry, "/")+1:]
+		if s.VCS == "git" {
+			s.Name = strings.TrimSuffix(s.Name, ".git")
+		}
+	}
+
+	return
+}
+
+/*
+Supported reports whether the upstream head of s can be queried.
+*/
+func (s Source) Supported() bool {
+	return slices.Contains(supported, s.VCS)
+}
+
+/*
+Head queries the upstream repository of s for the identifier of its current head.
+The fragment selects the branch or revision to query; a fixed commit, tag or revision is returned as-is.
+The query uses the VCS's command line client, which must be installed.
+*/
+func (s Source) Head() (string, error) {
+	// URLs come from .SRCINFO files and must not be taken as options
+	if strings.HasPrefix(s.URL, "-") {
+		return "", fmt.Errorf("invalid source URL '%s'", s.URL)
+	}
+	kind, ref, _ := strings.Cut(s.Fragment, "=")
+	switch s.VCS {
+	case "git":
+		switch kind {
+		case "commit", "tag":
+			return ref, nil
+		case "branch":
+			ref = "refs/heads/" + ref
+		default:
+			ref = "HEAD"
+		}
+		out, err := run("git", "ls-remote", "--", s.URL, ref)
+		if err != nil {
+			return "", err
+		}
+		hash, _, _ := strings.Cut(out, "\t")
+		if hash == "" {
+			return "", fmt.Errorf("reference '%s' not found in %s", ref, s.URL)
+		}
+		return hash, nil
+	case "hg":
+		switch kind {
+		case "revision", "tag":
+			return ref, nil
+		case "branch":
+		default:
+			ref = "default"
+		}
+		return run("hg", "identify", "--id", "--rev", ref, "--", s.URL)
+	case "svn":
+		if kind == "revision" {
+			return ref, nil
+		}
+		return run("svn", "info", "--show-item", "revision", "--", s.URL)
+	default:
+		return "", fmt.Errorf("unsupported version control system '%s'", s.VCS)
+	}
+}
+
+/*
+Revision extracts the upstream revision recorded in the version of a package built from s,
+following the pkgver formats of the VCS package guidelines: "[tag.]r<count>.g<hash>" for git,
+"r<count>.<id>" for hg and "r<revision>" for svn. Any epoch and pkgrel are ignored.
+Git revisions are usually abbreviated, so compare them with SameRevision.
+An empty string is returned if the version records no revision.
+*/
+func (s Source) Revision(version string) string {
+	if _, v, ok := strings.Cut(version, ":"); ok {
+		version = v
+	}
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	last := parts[len(parts)-1]
+
+	switch s.VCS {
+	case "git":
+		// the "g" prefix of git describe marks a hash; a bare hash must follow the commit count
+		if hash, ok := strings.CutPrefix(last, "g"); ok && len(hash) >= 7 && isHex(hash) {
+			return hash
+		}
+		fallthrough
+	case "hg":
+		if len(parts) > 1 && isCount(parts[len(parts)-2]) && len(last) >= 7 && isHex(last) {
+			return last
+		}
+	case "svn":
+		for i := len(parts) - 1; i >= 0; i-- {
+			if isCount(parts[i]) {
+				return parts[i][1:]
+			}
+		}
+	}
+
+	return ""
+}
+
+/*
+SameRevision reports whether the revision recorded for s matches the upstream head.
+Recorded git hashes may be abbreviated to a prefix of the head.
+*/
+func (s Source) SameRevision(recorded, head string) bool {
+	if recorded == head {
+		return true
+	}
+
+	return s.VCS == "git" && len(recorded) >= 7 && strings.HasPrefix(head, recorded)
+}
+
+// isHex reports whether s consists of lowercase hexadecimal digits.
+func isHex(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// isCount reports whether s is a revision count such as "r1234".
+func isCount(s string) bool {
+	count, ok := strings.CutPrefix(s, "r")
+	return ok && count != "" && strings.Trim(count, "0123456789") == ""
+}
+
+// run executes a command and returns its trimmed standard output.
+func run(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(name, args...)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,183 @@
+/*
+ * vcs_test.go
+ *
+ * Copyright (c) 2024 Brandon Moller
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a git repository in a temporary directory holding a single commit.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git(t, dir, "init", "--quiet", "--initial-branch=main")
+	commit(t, dir)
+
+	return dir
+}
+
+// commit adds an empty commit to the repository in dir and returns its hash.
+func commit(t *testing.T, dir string) string {
+	t.Helper()
+	git(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "--message=test")
+
+	return git(t, dir, "rev-parse", "HEAD")
+}
+
+// git runs a git command in dir and returns its trimmed output.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  Source
+	}{
+		{"https://example.com/foo-1.0.tar.gz", Source{Name: "foo-1.0.tar.gz", URL: "https://example.com/foo-1.0.tar.gz"}},
+		{"git+https://example.com/foo.git", Source{Name: "foo", VCS: "git", URL: "https://example.com/foo.git"}},
+		{"bar::git+https://example.com/foo.git#branch=dev", Source{Name: "bar", VCS: "git", URL: "https://example.com/foo.git", Fragment: "branch=dev"}},
+		{"git://example.com/foo.git#tag=v1.0", Source{Name: "foo", VCS: "git", URL: "git://example.com/foo.git", Fragment: "tag=v1.0"}},
+		{"hg+https://example.com/foo", Source{Name: "foo", VCS: "hg", URL: "https://example.com/foo"}},
+		{"svn+https://example.com/foo/trunk#revision=123", Source{Name: "trunk", VCS: "svn", URL: "https://example.com/foo/trunk", Fragment: "revision=123"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			if got := ParseSource(tt.entry); got != tt.want {
+				t.Errorf("ParseSource(%q) = %+v, want %+v", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevision(t *testing.T) {
+	tests := []struct {
+		vcs     string
+		version string
+		want    string
+	}{
+		{"git", "r123.gabcdef0-1", "abcdef0"},
+		{"git", "1:1.2.3.r45.g0123456789ab-2", "0123456789ab"},
+		{"git", "r123.abcdef0-1", "abcdef0"},
+		{"git", "1.2.3-1", ""},
+		{"git", "1.0.20240101-1", ""},
+		{"git", "r123.gabc-1", ""},
+		{"hg", "r42.0123456789ab-1", "0123456789ab"},
+		{"hg", "0.1-1", ""},
+		{"svn", "r1234-1", "1234"},
+		{"svn", "2.0.r1234-3", "1234"},
+		{"svn", "2.0-1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vcs+" "+tt.version, func(t *testing.T) {
+			if got := (Source{VCS: tt.vcs}).Revision(tt.version); got != tt.want {
+				t.Errorf("Revision(%q) = %q, want %q", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameRevision(t *testing.T) {
+	head := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		vcs      string
+		recorded string
+		head     string
+		want     bool
+	}{
+		{"git", head, head, true},
+		{"git", "0123456", head, true},
+		{"git", "012345", head, false},
+		{"git", "1234567", head, false},
+		{"svn", "12", "123", false},
+		{"svn", "123", "123", true},
+	}
+	for _, tt := range tests {
+		if got := (Source{VCS: tt.vcs}).SameRevision(tt.recorded, tt.head); got != tt.want {
+			t.Errorf("%s SameRevision(%q, %q) = %v, want %v", tt.vcs, tt.recorded, tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestHeadGit(t *testing.T) {
+	dir := initRepo(t)
+	first := git(t, dir, "rev-parse", "HEAD")
+	git(t, dir, "branch", "dev")
+	git(t, dir, "tag", "v1.0")
+	second := commit(t, dir)
+
+	tests := []struct {
+		fragment string
+		want     string
+	}{
+		{"", second},
+		{"branch=main", second},
+		{"branch=dev", first},
+		{"commit=" + first, first},
+		{"tag=v1.0", "v1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fragment, func(t *testing.T) {
+			s := ParseSource("git+file://" + dir + "#" + tt.fragment)
+			got, err := s.Head()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Head() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseSource("git+file://" + dir + "#branch=missing").Head(); err == nil {
+		t.Error("Head() of a missing branch succeeded")
+	}
+}
+
+func TestHeadOptionURL(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	for _, entry := range []string{
+		"git+--upload-pack=touch " + marker + ";://x",
+		"hg+--config=hooks.pre-identify=touch " + marker + ";://x",
+		"svn+--config-option=x;://x",
+	} {
+		s := ParseSource(entry)
+		if _, err := s.Head(); err == nil {
+			t.Errorf("Head() of %q succeeded", entry)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("command in source URL was run")
+	}
+}